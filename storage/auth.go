@@ -1,19 +1,23 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	authURL          = "https://auth.selcdn.ru/"
+	defaultAuthURL   = "https://auth.selcdn.ru/"
 	authUserHeader   = "X-Auth-User"
 	authKeyHeader    = "X-Auth-Key"
 	authExpireHeader = "X-Expire-Auth-Token"
 	storageURLHeader = "X-Storage-Url"
+	// tempAuthExpireHeader is used by swift TempAuth instead of authExpireHeader
+	tempAuthExpireHeader = "X-Auth-Token-Expires"
 	// tokenDurationAdd used to reduce duration of token
 	// to re-auth before token gets expired
 	tokenDurationAdd = 10 * time.Second
@@ -26,58 +30,209 @@ var (
 	ErrorBadCredentials = errors.New("Bad auth credentials provided")
 )
 
-// Token returns current auth token
-func (c *Client) Token() string {
-	return c.token
+// Authenticator obtains auth token and storage url for provided credentials
+type Authenticator interface {
+	// Authenticate performs authentication with client, that does not
+	// require auth token
+	Authenticate(client DoClient, user, key string) (*AuthToken, error)
 }
 
-// Auth performs authentication to selectel and stores token and storage url
-func (c *Client) Auth(user, key string) error {
-	if blank(user) || blank(key) {
-		return ErrorBadCredentials
-	}
+// AuthToken is result of authentication
+type AuthToken struct {
+	Token      string
+	StorageURL string
+	// Expire is token lifetime in seconds
+	Expire int
+}
 
-	request, _ := http.NewRequest(getMethod, authURL, nil)
+// V1Auth is selectel authentication, that also supports
+// OpenStack Swift TempAuth (v1)
+type V1Auth struct {
+	URL      string
+	TempAuth bool
+}
+
+// Authenticate performs request to auth url with user and key in headers
+func (a *V1Auth) Authenticate(client DoClient, user, key string) (*AuthToken, error) {
+	request, err := http.NewRequest(getMethod, a.URL, nil)
+	if err != nil {
+		return nil, err
+	}
 	request.Header.Add(authUserHeader, user)
 	request.Header.Add(authKeyHeader, key)
 
-	res, err := c.do(request)
+	res, err := client.Do(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusNoContent {
-		return ErrorAuth
+	// selectel responds with 204 and TempAuth with 200
+	if res.StatusCode != http.StatusNoContent && !(a.TempAuth && res.StatusCode == http.StatusOK) {
+		return nil, ErrorAuth
+	}
+	expireHeader := authExpireHeader
+	if a.TempAuth {
+		expireHeader = tempAuthExpireHeader
 	}
-	expire, err := strconv.Atoi(res.Header.Get(authExpireHeader))
+	expire, err := strconv.Atoi(res.Header.Get(expireHeader))
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	return &AuthToken{
+		Token:      res.Header.Get(authTokenHeader),
+		StorageURL: res.Header.Get(storageURLHeader),
+		Expire:     expire,
+	}, nil
+}
+
+// Token returns current auth token
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// load sets credentials from token store if they are valid for user
+func (c *Client) load(user string) bool {
+	if c.store == nil {
+		return false
+	}
+	cache, err := c.store.Load()
+	if err != nil || cache.expired(c.clock.Now()) || cache.Token == c.rejected {
+		return false
+	}
+	if !blank(cache.User) && cache.User != user {
+		return false
+	}
+	return c.setCredentials(cache) == nil
+}
+
+// save stores credentials in token store
+func (c *Client) save() {
+	if c.store == nil {
+		return
 	}
+	if err := c.store.Save(c.cache()); err != nil {
+		c.log(context.Background(), LevelWarn, "unable to save token", "error", err.Error())
+	}
+}
+
+// Auth performs authentication with client authenticator and stores token and storage url.
+// Valid token from token store is used without authentication.
+func (c *Client) Auth(user, key string) (err error) {
+	ctx, span := c.startSpan(context.Background(), "Auth", "", "")
+	defer endSpan(span, &err)
+	return c.auth(ctx, user, key)
+}
+
+// auth is Auth, that requires c.mu not to be held
+func (c *Client) auth(ctx context.Context, user, key string) error {
+	if blank(user) || blank(key) {
+		return ErrorBadCredentials
+	}
+	c.mu.Lock()
+	loaded := c.load(user)
+	if loaded {
+		c.user, c.key = user, key
+		c.reschedule()
+	}
+	c.mu.Unlock()
+	if loaded {
+		return nil
+	}
+	return c.authenticate(ctx, user, key)
+}
 
-	c.tokenExpire = expire
-	c.token = res.Header.Get(authTokenHeader)
+// authFlight is authentication, that is shared by concurrent callers
+type authFlight struct {
+	done chan struct{}
+	err  error
+}
+
+// authenticate obtains new token with authenticator, ignoring token store.
+// Concurrent calls share one authentication and c.mu is not held during
+// round trip, so requests with valid token are not blocked by renewal.
+// c.mu must not be held.
+func (c *Client) authenticate(ctx context.Context, user, key string) error {
+	c.mu.Lock()
+	if f := c.flight; f != nil {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	f := &authFlight{done: make(chan struct{})}
+	c.flight = f
+	c.mu.Unlock()
+
+	token, err := c.obtain(ctx, user, key)
+	c.mu.Lock()
+	if err == nil {
+		err = c.setToken(token, user, key)
+	}
+	c.flight = nil
+	c.mu.Unlock()
+	f.err = err
+	close(f.done)
+	return err
+}
+
+// obtain requests new token with authenticator
+func (c *Client) obtain(ctx context.Context, user, key string) (_ *AuthToken, err error) {
+	ctx, span := c.tracer.Start(ctx, spanPrefix+"authenticate")
+	defer endSpan(span, &err)
+	// requests of authenticator are children of span and are not
+	// attempts of request, that required authentication
+	ctx = context.WithValue(ctx, attemptKey{}, 1)
+	client := DoFunc(func(request *http.Request) (*http.Response, error) {
+		return c.authChain.Do(request.WithContext(ctx))
+	})
+	return c.authenticator.Authenticate(client, user, key)
+}
+
+// setToken stores token of user, c.mu must be held
+func (c *Client) setToken(token *AuthToken, user, key string) (err error) {
+	c.tokenExpire = token.Expire
+	c.token = token.Token
 	if blank(c.token) {
 		return ErrorAuth
 	}
-	c.storageURL, err = url.Parse(res.Header.Get(storageURLHeader))
+	c.storageURL, err = url.Parse(token.StorageURL)
 	if err != nil || blank(c.storageURL.String()) {
 		return ErrorAuth
 	}
+	// swift storage url has no trailing slash, e.g. http://127.0.0.1:8080/v1/AUTH_test
+	if !strings.HasSuffix(c.storageURL.Path, "/") {
+		c.storageURL.Path += "/"
+	}
 
 	c.user, c.key = user, key
-	now := time.Now()
+	now := c.clock.Now()
 	c.expireFrom = &now
+	c.save()
+	c.reschedule()
 
 	return nil
 }
 
 // Expired returns true if token is expired or does not exist
 func (c *Client) Expired() bool {
-	if c.expireFrom == nil || blank(c.token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return expired(c.token, c.expireFrom, c.tokenExpire, c.clock.Now())
+}
+
+// expired returns true if token is expired at now
+func expired(token string, expireFrom *time.Time, expire int, now time.Time) bool {
+	if expireFrom == nil || blank(token) {
 		return true
 	}
-	duration := time.Duration(c.tokenExpire) * time.Second
-	expiredFrom := c.expireFrom.Add(duration).Add(tokenDurationAdd)
-	return expiredFrom.Before(time.Now())
+	duration := time.Duration(expire) * time.Second
+	expiredFrom := expireFrom.Add(duration).Add(-tokenDurationAdd)
+	return expiredFrom.Before(now)
 }
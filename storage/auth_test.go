@@ -5,7 +5,9 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
@@ -46,12 +48,109 @@ func (c *TestClient) Do(request *http.Request) (res *http.Response, err error) {
 	return res, err
 }
 
+// authenticatorFunc is function adapter for Authenticator
+type authenticatorFunc func(client DoClient, user, key string) (*AuthToken, error)
+
+func (f authenticatorFunc) Authenticate(client DoClient, user, key string) (*AuthToken, error) {
+	return f(client, user, key)
+}
+
+// testClock is Clock, that is moved manually by Add, timers fire when
+// clock is moved past their deadlines
+type testClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*testTimer
+	// added is closed and replaced when timer is created
+	added chan struct{}
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC), added: make(chan struct{})}
+}
+
+// waitTimers waits until n timers are active, false is returned if they
+// are not created in 5 seconds
+func (c *testClock) waitTimers(n int) bool {
+	timeout := time.After(5 * time.Second)
+	for {
+		c.mu.Lock()
+		count, added := len(c.timers), c.added
+		c.mu.Unlock()
+		if count >= n {
+			return true
+		}
+		select {
+		case <-added:
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &testTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	close(c.added)
+	c.added = make(chan struct{})
+	return t
+}
+
+func (c *testClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = timers
+}
+
+type testTimer struct {
+	clock    *testClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *testTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *testTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 func forceBadURL(c *Client) {
 	c.storageURL.Host = invalidHost
 }
 
 func TestAuth(t *testing.T) {
-	c := newClient(nil)
+	c := newClient()
 	Convey("Auth", t, func() {
 		Convey("Ok", func() {
 			resp := new(http.Response)
@@ -67,6 +166,81 @@ func TestAuth(t *testing.T) {
 			So(c.tokenExpire, ShouldEqual, 110)
 			So(c.Token(), ShouldEqual, "token")
 		})
+		Convey("Auth url", func() {
+			c := newClient(WithAuthURL("http://127.0.0.1:8080/auth/v1.0"))
+			callback := func(request *http.Request) (*http.Response, error) {
+				So(request.URL.String(), ShouldEqual, "http://127.0.0.1:8080/auth/v1.0")
+				So(request.Header.Get("X-Auth-User"), ShouldEqual, "user")
+				So(request.Header.Get("X-Auth-Key"), ShouldEqual, "key")
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				resp.StatusCode = http.StatusNoContent
+				return resp, nil
+			}
+			c.setClient(NewTestClient(callback))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.Token(), ShouldEqual, "token")
+			Convey("Bad", func() {
+				c := newClient(WithAuthURL(invalidHost))
+				So(c.Auth("user", "key"), ShouldNotBeNil)
+			})
+		})
+		Convey("TempAuth", func() {
+			c := newClient(WithAuthURL("http://127.0.0.1:8080/auth/v1.0"), WithTempAuth())
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.Header.Add("X-Auth-Token-Expires", "86399")
+			resp.Header.Add("X-Auth-Token", "AUTH_tk")
+			resp.Header.Add("X-Storage-Url", "http://127.0.0.1:8080/v1/AUTH_test")
+			resp.StatusCode = http.StatusOK
+			c.setClient(NewTestClientSimple(resp))
+			So(c.Auth("test:tester", "testing"), ShouldBeNil)
+			So(c.Token(), ShouldEqual, "AUTH_tk")
+			So(c.tokenExpire, ShouldEqual, 86399)
+			So(c.storageURL.String(), ShouldEqual, "http://127.0.0.1:8080/v1/AUTH_test/")
+			So(c.URL("container", "object"), ShouldEqual, "http://127.0.0.1:8080/v1/AUTH_test/container/object")
+			Convey("Selectel mode", func() {
+				c := newClient()
+				c.setClient(NewTestClientSimple(resp))
+				So(c.Auth("test:tester", "testing"), ShouldEqual, ErrorAuth)
+			})
+		})
+		Convey("Authenticator", func() {
+			var auths int
+			authenticator := authenticatorFunc(func(client DoClient, user, key string) (*AuthToken, error) {
+				auths++
+				So(user, ShouldEqual, "user")
+				So(key, ShouldEqual, "key")
+				return &AuthToken{Token: "token", StorageURL: "https://xxx.selcdn.ru", Expire: 110}, nil
+			})
+			c := newClient(WithAuthenticator(authenticator))
+			callback := func(request *http.Request) (*http.Response, error) {
+				So(request.Header.Get("X-Auth-Token"), ShouldEqual, "token")
+				resp := new(http.Response)
+				resp.StatusCode = http.StatusNoContent
+				return resp, nil
+			}
+			c.setClient(NewTestClient(callback))
+			c.user, c.key = "user", "key"
+			So(c.RemoveObject("container", "object"), ShouldBeNil)
+			So(auths, ShouldEqual, 1)
+			So(c.storageURL.String(), ShouldEqual, "https://xxx.selcdn.ru/")
+			Convey("Re-auth", func() {
+				c.expireFrom = nil
+				So(c.RemoveObject("container", "object"), ShouldBeNil)
+				So(auths, ShouldEqual, 2)
+			})
+			Convey("Error", func() {
+				failing := authenticatorFunc(func(client DoClient, user, key string) (*AuthToken, error) {
+					return nil, ErrorAuth
+				})
+				c := newClient(WithAuthenticator(failing))
+				So(c.Auth("user", "key"), ShouldEqual, ErrorAuth)
+			})
+		})
 		Convey("Bad url", func() {
 			Convey("Request", func() {
 				resp := new(http.Response)
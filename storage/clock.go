@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"time"
+)
+
+// Clock is source of time, that is used for token expiration,
+// renewal and timestamps, so it can be replaced in tests
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns timer, that fires after duration d
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is time.Timer, that is created by Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// SystemClock is Clock of time package
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// clockOrSystem returns clock or SystemClock if clock is nil
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
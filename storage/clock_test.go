@@ -0,0 +1,90 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiration(t *testing.T) {
+	Convey("Clock", t, func() {
+		clock := newTestClock()
+		var auths int
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.StatusCode = http.StatusNoContent
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				auths++
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token"+strconv.Itoa(auths))
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+			}
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock))
+		Convey("Expiration", func() {
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.expireFrom.Equal(clock.Now()), ShouldBeTrue)
+			clock.Add(99 * time.Second)
+			So(c.Expired(), ShouldBeFalse)
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(auths, ShouldEqual, 1)
+			clock.Add(2 * time.Second)
+			So(c.Expired(), ShouldBeTrue)
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(auths, ShouldEqual, 2)
+			So(c.Token(), ShouldEqual, "token2")
+		})
+		Convey("Token store", func() {
+			store := NewMemoryTokenStore()
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithTokenStore(store))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			clock.Add(time.Minute)
+			other := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithTokenStore(store))
+			So(other.Auth("user", "key"), ShouldBeNil)
+			So(auths, ShouldEqual, 1)
+			clock.Add(time.Minute)
+			other = newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithTokenStore(store))
+			So(other.Auth("user", "key"), ShouldBeNil)
+			So(auths, ShouldEqual, 2)
+		})
+		Convey("Env token store", func() {
+			defer os.Unsetenv(EnvToken)
+			defer os.Unsetenv(EnvStorageURL)
+			defer os.Unsetenv(EnvTokenExpires)
+			now := clock.Now()
+			store := EnvTokenStore{Clock: clock}
+			So(store.Save(ClientCredentials{Token: "token", URL: "https://xxx.selcdn.ru/", Expire: 110, ExpireFrom: &now}), ShouldBeNil)
+			clock.Add(100 * time.Second)
+			cache, err := store.Load()
+			So(err, ShouldBeNil)
+			So(cache.Expire, ShouldEqual, 10)
+			So(cache.ExpireFrom.Equal(clock.Now()), ShouldBeTrue)
+		})
+		Convey("Objects info location", func() {
+			location := time.FixedZone("MSK", 3*60*60)
+			clock.now = clock.now.In(location)
+			So(c.Auth("user", "key"), ShouldBeNil)
+			c.setClient(NewTestClient(func(request *http.Request) (*http.Response, error) {
+				if request.URL.String() == "https://auth.selcdn.ru/" {
+					return callback(request)
+				}
+				resp := new(http.Response)
+				resp.StatusCode = http.StatusOK
+				resp.Body = ioutil.NopCloser(strings.NewReader(`[{"bytes": 1, "content_type": "text/plain", "hash": "x", "last_modified": "2017-01-01T09:00:00.000000", "name": "o"}]`))
+				return resp, nil
+			}))
+			info, err := c.ObjectsInfo("c")
+			So(err, ShouldBeNil)
+			So(info, ShouldHaveLength, 1)
+			So(info[0].LastModified.Location(), ShouldEqual, location)
+			So(info[0].LastModified.Hour(), ShouldEqual, 12)
+		})
+	})
+}
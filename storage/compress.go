@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strconv"
+)
+
+const (
+	contentEncodingHeader = "Content-Encoding"
+	acceptEncodingHeader  = "Accept-Encoding"
+	identityEncoding      = "identity"
+
+	// EncodingGzip is gzip content encoding
+	EncodingGzip = "gzip"
+	// EncodingZstd is zstd content encoding
+	EncodingZstd = "zstd"
+	// OriginalSizeKey is metadata key of size of data before compression
+	OriginalSizeKey = "Original-Size"
+)
+
+var (
+	// ErrorBadEncoding is returned for unsupported content encoding
+	ErrorBadEncoding = errors.New("Unsupported content encoding, expected gzip or zstd")
+)
+
+// Compress compresses uploaded data with encoding, EncodingGzip or
+// EncodingZstd, and sets Content-Encoding of object. Size of data before
+// compression is stored in metadata with OriginalSizeKey. Data of object
+// with encoding is decompressed by GetReader
+func Compress(encoding string) TransferOption {
+	return func(t *transfer) {
+		t.encoding = encoding
+	}
+}
+
+// RequestedEncoding returns content encoding, that is requested by
+// options, e.g. for implementations of API
+func RequestedEncoding(opts ...TransferOption) string {
+	return newTransfer(opts, SystemClock).encoding
+}
+
+// compressed returns true for encodings, that are decompressed on read
+func compressed(encoding string) bool {
+	return encoding == EncodingGzip || encoding == EncodingZstd
+}
+
+// CompressReader returns reader of data from r compressed with encoding,
+// data is compressed by goroutine, that stops when reader is closed
+func CompressReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	reader, writer := io.Pipe()
+	var (
+		compressor io.WriteCloser
+		err        error
+	)
+	switch encoding {
+	case EncodingGzip:
+		compressor = gzip.NewWriter(writer)
+	case EncodingZstd:
+		compressor, err = zstd.NewWriter(writer)
+	default:
+		err = ErrorBadEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_, err := io.Copy(compressor, r)
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// DecompressReader returns reader of data from r decompressed with
+// encoding, closing of reader closes r if it is io.Closer
+func DecompressReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	var (
+		decompressor io.ReadCloser
+		err          error
+	)
+	switch encoding {
+	case EncodingGzip:
+		decompressor, err = gzip.NewReader(r)
+	case EncodingZstd:
+		var decoder *zstd.Decoder
+		if decoder, err = zstd.NewReader(r); err == nil {
+			decompressor = decoder.IOReadCloser()
+		}
+	default:
+		err = ErrorBadEncoding
+	}
+	if err != nil {
+		return nil, err
+	}
+	closer, ok := r.(io.Closer)
+	if !ok {
+		return decompressor, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decompressor, multiCloser{decompressor, closer}}, nil
+}
+
+// multiCloser closes all closers and returns first error
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() error {
+	var err error
+	for _, closer := range m {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// countingReader counts bytes, that are read
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// originalSize returns size of data before compression from metadata or
+// -1 if it is unknown
+func originalSize(metadata map[string]string) int64 {
+	size, err := strconv.ParseInt(metadata[OriginalSizeKey], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
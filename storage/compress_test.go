@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func gzipData(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	writer := gzip.NewWriter(buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func TestCompress(t *testing.T) {
+	c := newClient()
+	Convey("Compress", t, func() {
+		resp := new(http.Response)
+		resp.Header = http.Header{}
+		resp.Header.Add("X-Expire-Auth-Token", "110")
+		resp.Header.Add("X-Auth-Token", "token")
+		resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+		resp.StatusCode = http.StatusNoContent
+		c.setClient(NewTestClientSimple(resp))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		data := []byte(strings.Repeat("data", 1024))
+		compressedData := gzipData(data)
+		Convey("Reader", func() {
+			reader, err := CompressReader(bytes.NewReader(data), EncodingGzip)
+			So(err, ShouldBeNil)
+			decompressed, err := DecompressReader(reader, EncodingGzip)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(decompressed)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+			So(decompressed.Close(), ShouldBeNil)
+			_, err = CompressReader(bytes.NewReader(data), "br")
+			So(err, ShouldEqual, ErrorBadEncoding)
+			_, err = DecompressReader(bytes.NewReader(data), "br")
+			So(err, ShouldEqual, ErrorBadEncoding)
+		})
+		Convey("Upload", func() {
+			callback := func(request *http.Request) (resp *http.Response, err error) {
+				resp = new(http.Response)
+				So(request.Header.Get("Content-Encoding"), ShouldEqual, EncodingGzip)
+				So(request.Header.Get("X-Object-Meta-Original-Size"), ShouldEqual, strconv.Itoa(len(data)))
+				body, err := ioutil.ReadAll(request.Body)
+				So(err, ShouldBeNil)
+				So(len(body), ShouldBeLessThan, len(data))
+				reader, err := gzip.NewReader(bytes.NewReader(body))
+				So(err, ShouldBeNil)
+				decompressed, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(decompressed, ShouldResemble, data)
+				So(request.Header.Get("etag"), ShouldEqual, fmt.Sprintf("%x", md5.Sum(body)))
+				resp.StatusCode = http.StatusCreated
+				return
+			}
+			c.setClient(NewTestClient(callback))
+			So(c.Upload(bytes.NewReader(data), "container", "filename", "text/plain", Compress(EncodingGzip)), ShouldBeNil)
+			So(RequestedEncoding(Compress(EncodingZstd)), ShouldEqual, EncodingZstd)
+			So(c.Upload(bytes.NewReader(data), "container", "filename", "text/plain", Compress("br")), ShouldEqual, ErrorBadEncoding)
+		})
+		Convey("GetReader", func() {
+			var ranges []string
+			callback := func(request *http.Request) (resp *http.Response, err error) {
+				resp = new(http.Response)
+				resp.Header = http.Header{}
+				resp.Header.Set("Content-Encoding", EncodingGzip)
+				resp.Header.Set("X-Object-Meta-Original-Size", strconv.Itoa(len(data)))
+				So(request.Method, ShouldEqual, "GET")
+				So(request.Header.Get("Accept-Encoding"), ShouldEqual, "identity")
+				ranges = append(ranges, request.Header.Get("Range"))
+				switch request.Header.Get("Range") {
+				case "":
+				case "bytes=10-19":
+					// range of stored data is returned as is
+					resp.StatusCode = http.StatusPartialContent
+					resp.ContentLength = 10
+					resp.Body = ioutil.NopCloser(bytes.NewReader(compressedData[10:20]))
+					return
+				default:
+					// offset after end of stored data
+					resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+					return
+				}
+				resp.StatusCode = http.StatusOK
+				resp.ContentLength = int64(len(compressedData))
+				resp.Body = ioutil.NopCloser(bytes.NewReader(compressedData))
+				return
+			}
+			c.setClient(NewTestClient(callback))
+			object := c.Container("container").Object("filename")
+			read := func(opts ...TransferOption) []byte {
+				reader, err := object.GetReader(opts...)
+				So(err, ShouldBeNil)
+				dataRead, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(reader.Close(), ShouldBeNil)
+				return dataRead
+			}
+			So(read(), ShouldResemble, data)
+			Convey("Range", func() {
+				So(read(Range(10, 10)), ShouldResemble, data[10:20])
+				So(read(Range(2000, 10)), ShouldResemble, data[2000:2010])
+				So(read(Range(4000, 0)), ShouldResemble, data[4000:])
+				So(ranges, ShouldResemble, []string{"", "bytes=10-19", "", "bytes=2000-2009", "", "bytes=4000-", ""})
+			})
+			Convey("Download", func() {
+				downloaded, err := object.Download()
+				So(err, ShouldBeNil)
+				So(downloaded, ShouldResemble, data)
+			})
+		})
+		Convey("Info", func() {
+			callback := func(request *http.Request) (resp *http.Response, err error) {
+				resp = new(http.Response)
+				resp.Header = http.Header{}
+				resp.Header.Set("Content-Encoding", EncodingGzip)
+				resp.Header.Set("X-Object-Meta-Original-Size", strconv.Itoa(len(data)))
+				resp.Header.Set("last-modified", "Mon, 21 May 2013 12:27:11 GMT")
+				resp.ContentLength = int64(len(compressedData))
+				resp.StatusCode = http.StatusOK
+				return
+			}
+			c.setClient(NewTestClient(callback))
+			info, err := c.ObjectInfo("container", "filename")
+			So(err, ShouldBeNil)
+			So(info.ContentEncoding, ShouldEqual, EncodingGzip)
+			So(info.Size, ShouldEqual, len(data))
+			So(info.StoredSize, ShouldEqual, len(compressedData))
+		})
+	})
+}
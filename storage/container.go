@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -13,6 +14,10 @@ const (
 	containerPrivate           = "private"
 	containerBytesUserHeader   = "X-Container-Bytes-Used"
 	containerObjectCountHeader = "X-Container-Object-Count"
+	// containerReadHeader is swift acl header, that is used for public containers in TempAuth mode
+	containerReadHeader       = "X-Container-Read"
+	containerRemoveReadHeader = "X-Remove-Container-Read"
+	containerPublicACL        = ".r:*,.rlistings"
 )
 
 var (
@@ -39,8 +44,8 @@ type ContainerInfo struct {
 // ContainerAPI is interface for selectel storage container
 type ContainerAPI interface {
 	Name() string
-	Upload(reader io.Reader, name, contentType string) error
-	UploadFile(filename string) error
+	Upload(reader io.Reader, name, contentType string, opts ...TransferOption) error
+	UploadFile(filename string, opts ...TransferOption) error
 	URL(filename string) string
 	RemoveObject(name string) error
 	// Remove removes current container
@@ -51,15 +56,15 @@ type ContainerAPI interface {
 	ObjectInfo(name string) (ObjectInfo, error)
 	// Object returns object from container
 	Object(name string) ObjectAPI
-	ObjectsInfo() ([]ObjectInfo, error)
+	ObjectsInfo(opts ...ListOption) ([]ObjectInfo, error)
 	Objects() ([]ObjectAPI, error)
 	Info() (info ContainerInfo, err error)
 }
 
 // Upload reads all data from reader and uploads to contaier with filename and content type
 // shortcut to API.Upload
-func (c *Container) Upload(reader io.Reader, filename, contentType string) error {
-	return c.api.Upload(reader, c.name, filename, contentType)
+func (c *Container) Upload(reader io.Reader, filename, contentType string, opts ...TransferOption) error {
+	return c.api.Upload(reader, c.name, filename, contentType, opts...)
 }
 
 // Name returns container name
@@ -88,8 +93,8 @@ func (c *Container) URL(filename string) string {
 }
 
 // UploadFile to current container. Shortcut to API.UploadFile
-func (c *Container) UploadFile(filename string) error {
-	return c.api.UploadFile(filename, c.name)
+func (c *Container) UploadFile(filename string, opts ...TransferOption) error {
+	return c.api.UploadFile(filename, c.name, opts...)
 }
 
 // DeleteObject is shortcut to API.DeleteObject
@@ -109,9 +114,10 @@ func (c *Container) Object(name string) ObjectAPI {
 	return object
 }
 
-// ObjectsInfo returns information about all objects in container
-func (c *Container) ObjectsInfo() ([]ObjectInfo, error) {
-	return c.api.ObjectsInfo(c.name)
+// ObjectsInfo returns information about all objects in container,
+// that match options
+func (c *Container) ObjectsInfo(opts ...ListOption) ([]ObjectInfo, error) {
+	return c.api.ObjectsInfo(c.name, opts...)
 }
 
 // Objects returns all object from container
@@ -147,8 +153,10 @@ func (c *Client) Container(name string) ContainerAPI {
 
 // CreateContainer creates new container and retuns it.
 // If container already exists, function will return existing container
-func (c *Client) CreateContainer(name string, private bool) (ContainerAPI, error) {
-	req, err := c.NewRequest(putMethod, nil, name)
+func (c *Client) CreateContainer(name string, private bool) (_ ContainerAPI, err error) {
+	ctx, span := c.startSpan(context.Background(), "CreateContainer", name, "")
+	defer endSpan(span, &err)
+	req, err := c.newRequest(ctx, putMethod, nil, name)
 	if err != nil {
 		return nil, err
 	}
@@ -158,6 +166,14 @@ func (c *Client) CreateContainer(name string, private bool) (ContainerAPI, error
 		containerType = containerPrivate
 	}
 	req.Header.Add(containerMetaTypeHeader, containerType)
+	if c.tempAuth {
+		// stock swift has no container types, so public access is granted by acl
+		if private {
+			req.Header.Add(containerRemoveReadHeader, "1")
+		} else {
+			req.Header.Add(containerReadHeader, containerPublicACL)
+		}
+	}
 	res, err := c.Do(req)
 	if err != nil {
 		return nil, err
@@ -170,8 +186,10 @@ func (c *Client) CreateContainer(name string, private bool) (ContainerAPI, error
 
 // RemoveContainer removes container with provided name
 // Container should be empty before removing and must exist
-func (c *Client) RemoveContainer(name string) error {
-	req, err := c.NewRequest(deleteMethod, nil, name)
+func (c *Client) RemoveContainer(name string) (err error) {
+	ctx, span := c.startSpan(context.Background(), "RemoveContainer", name, "")
+	defer endSpan(span, &err)
+	req, err := c.newRequest(ctx, deleteMethod, nil, name)
 	if err != nil {
 		return err
 	}
@@ -192,7 +210,9 @@ func (c *Client) RemoveContainer(name string) error {
 }
 
 func (c *Client) ContainerInfo(name string) (info ContainerInfo, err error) {
-	req, err := c.NewRequest(headMethod, nil, name)
+	ctx, span := c.startSpan(context.Background(), "ContainerInfo", name, "")
+	defer endSpan(span, &err)
+	req, err := c.newRequest(ctx, headMethod, nil, name)
 	if err != nil {
 		return
 	}
@@ -11,10 +11,10 @@ import (
 )
 
 func TestContainerMethods(t *testing.T) {
-	c := newClient(nil)
+	c := newClient()
 	Convey("Methods", t, func() {
 		Convey("Expired", func() {
-			c := newClient(nil)
+			c := newClient()
 			So(c.Expired(), ShouldBeTrue)
 		})
 		resp := new(http.Response)
@@ -309,6 +309,36 @@ func TestContainerMethods(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(container.Name(), ShouldEqual, "container")
 			})
+			Convey("TempAuth", func() {
+				c.tempAuth = true
+				Reset(func() {
+					c.tempAuth = false
+				})
+				Convey("Public", func() {
+					callback := func(request *http.Request) (resp *http.Response, err error) {
+						resp = new(http.Response)
+						So(request.Header.Get("X-Container-Read"), ShouldEqual, ".r:*,.rlistings")
+						So(request.Header.Get("X-Container-Meta-Type"), ShouldEqual, "public")
+						resp.StatusCode = http.StatusCreated
+						return
+					}
+					c.setClient(NewTestClient(callback))
+					_, err := c.CreateContainer("container", false)
+					So(err, ShouldBeNil)
+				})
+				Convey("Private", func() {
+					callback := func(request *http.Request) (resp *http.Response, err error) {
+						resp = new(http.Response)
+						So(request.Header.Get("X-Container-Read"), ShouldEqual, "")
+						So(request.Header.Get("X-Remove-Container-Read"), ShouldEqual, "1")
+						resp.StatusCode = http.StatusCreated
+						return
+					}
+					c.setClient(NewTestClient(callback))
+					_, err := c.CreateContainer("container", true)
+					So(err, ShouldBeNil)
+				})
+			})
 			Convey("Shortcut", func() {
 				Convey("Ok", func() {
 					callback := func(request *http.Request) (resp *http.Response, err error) {
@@ -0,0 +1,302 @@
+// Package containerfs exposes storage container as io/fs file system,
+// so it can be used with fs.WalkDir, http.FS or template.ParseFS.
+//
+//	fsys := containerfs.New(api.Container("static"))
+//	http.Handle("/", http.FileServer(http.FS(fsys)))
+//
+// Object names are paths separated by slash, directories are prefixes
+// of names, that are listed with delimiter.
+package containerfs
+
+import (
+	"errors"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Separator is delimiter of directories in object names
+	Separator = "/"
+	// DirectoryContentType is content type of directory marker objects
+	DirectoryContentType = "application/directory"
+)
+
+var errIsDirectory = errors.New("is a directory")
+
+// FS is file system of container objects
+type FS struct {
+	container storage.ContainerAPI
+}
+
+var (
+	_ fs.FS        = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+// New returns file system of container
+func New(container storage.ContainerAPI) *FS {
+	return &FS{container: container}
+}
+
+// Open opens object or directory, objects are read lazily and support Seek
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &dir{fs: f, name: name, info: info}, nil
+	}
+	return &file{fs: f, name: name, info: info}, nil
+}
+
+// Stat returns FileInfo of object or directory
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadDir returns entries of directory sorted by name
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries, err := f.list(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	if len(entries) > 0 || name == "." {
+		return entries, nil
+	}
+	// empty listing is either object or not existing directory
+	info, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return entries, nil
+}
+
+// stat returns info of object or of directory, that is prefix of objects
+func (f *FS) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return dirInfo(name), nil
+	}
+	info, err := f.container.ObjectInfo(name)
+	if err == nil {
+		if info.ContentType == DirectoryContentType {
+			return dirInfo(name), nil
+		}
+		return &fileInfo{object: info}, nil
+	}
+	if err != storage.ErrorObjectNotFound {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	// single object is enough to find out, that directory exists
+	objects, err := f.container.ObjectsInfo(storage.Prefix(name+Separator), storage.Delimiter(Separator), storage.Limit(1))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if len(objects) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return dirInfo(name), nil
+}
+
+// list returns entries of directory from all pages of listing, directory
+// markers and objects, that are not valid paths, are skipped
+func (f *FS) list(name string) ([]fs.DirEntry, error) {
+	prefix := ""
+	if name != "." {
+		prefix = name + Separator
+	}
+	objects, err := storage.AllObjectsInfo(f.container, storage.Prefix(prefix), storage.Delimiter(Separator))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]*fileInfo)
+	for _, object := range objects {
+		if !blank(object.Subdir) {
+			entry := strings.TrimSuffix(strings.TrimPrefix(object.Subdir, prefix), Separator)
+			if fs.ValidPath(entry) && !strings.Contains(entry, Separator) {
+				entries[entry] = dirInfo(entry)
+			}
+			continue
+		}
+		entry := strings.TrimPrefix(object.Name, prefix)
+		if !fs.ValidPath(entry) || entry == "." || entries[entry] != nil {
+			continue
+		}
+		if object.ContentType == DirectoryContentType {
+			entries[entry] = dirInfo(entry)
+			continue
+		}
+		entries[entry] = &fileInfo{object: object}
+	}
+	result := make([]fs.DirEntry, 0, len(entries))
+	for _, info := range entries {
+		result = append(result, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+func blank(s string) bool {
+	return len(s) == 0
+}
+
+// fileInfo is fs.FileInfo of object or directory
+type fileInfo struct {
+	object storage.ObjectInfo
+	dir    bool
+}
+
+func dirInfo(name string) *fileInfo {
+	return &fileInfo{object: storage.ObjectInfo{Name: name}, dir: true}
+}
+
+func (i *fileInfo) Name() string {
+	return path.Base(i.object.Name)
+}
+
+func (i *fileInfo) Size() int64 {
+	return int64(i.object.Size)
+}
+
+// Mode returns read only mode of file or directory
+func (i *fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// ModTime returns last modification time of object with second
+// precision, that is same for listings and object info
+func (i *fileInfo) ModTime() time.Time {
+	return i.object.LastModified.Truncate(time.Second)
+}
+
+func (i *fileInfo) IsDir() bool {
+	return i.dir
+}
+
+// Sys returns storage.ObjectInfo
+func (i *fileInfo) Sys() interface{} {
+	return i.object
+}
+
+// file is object, that is downloaded from offset on first read
+type file struct {
+	fs     *FS
+	name   string
+	info   *fileInfo
+	offset int64
+	reader io.ReadCloser
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.offset >= f.info.Size() {
+		return 0, io.EOF
+	}
+	if f.reader == nil {
+		reader, err := f.fs.container.Object(f.name).GetReader(storage.Range(f.offset, 0))
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+		f.reader = reader
+	}
+	n, err := f.reader.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek changes offset, object is downloaded again from new offset
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset != f.offset && f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.reader == nil {
+		return nil
+	}
+	err := f.reader.Close()
+	f.reader = nil
+	return err
+}
+
+// dir is directory, that is listed on first ReadDir
+type dir struct {
+	fs      *FS
+	name    string
+	info    *fileInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDirectory}
+}
+
+// ReadDir returns next n entries or all remaining entries if n <= 0
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fs.list(d.name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+		d.entries, d.listed = entries, true
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *dir) Close() error {
+	return nil
+}
@@ -0,0 +1,165 @@
+package containerfs
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/storagetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"text/template"
+)
+
+func newMemoryFS() (*storagetest.Memory, *FS) {
+	m := storagetest.NewMemory()
+	container, err := m.CreateContainer("c", false)
+	So(err, ShouldBeNil)
+	for name, data := range map[string]string{
+		"index.html":          "<h1>index</h1>",
+		"a/hello.txt":         "hello world",
+		"a/b/deep.txt":        "deep",
+		"a/b/c/deeper.txt":    "deeper",
+		"templates/page.tmpl": "page {{.}}",
+	} {
+		So(container.Upload(bytes.NewBufferString(data), name, "text/plain"), ShouldBeNil)
+	}
+	// directory marker and object with invalid path are skipped
+	So(container.Upload(bytes.NewBufferString(""), "empty", DirectoryContentType), ShouldBeNil)
+	So(container.Upload(bytes.NewBufferString("x"), "a//bad", "text/plain"), ShouldBeNil)
+	return m, New(container)
+}
+
+func TestFS(t *testing.T) {
+	Convey("FS", t, func() {
+		m, fsys := newMemoryFS()
+		Convey("TestFS", func() {
+			So(fstest.TestFS(fsys, "index.html", "a/hello.txt", "a/b/deep.txt", "a/b/c/deeper.txt", "empty"), ShouldBeNil)
+		})
+		Convey("ReadDir", func() {
+			entries, err := fsys.ReadDir(".")
+			So(err, ShouldBeNil)
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			So(names, ShouldResemble, []string{"a", "empty", "index.html", "templates"})
+			So(entries[0].IsDir(), ShouldBeTrue)
+			So(entries[1].IsDir(), ShouldBeTrue)
+			So(entries[2].IsDir(), ShouldBeFalse)
+
+			entries, err = fsys.ReadDir("a")
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 2)
+			So(entries[0].Name(), ShouldEqual, "b")
+			So(entries[1].Name(), ShouldEqual, "hello.txt")
+
+			_, err = fsys.ReadDir("missing")
+			So(err, ShouldNotBeNil)
+			So(err.(*fs.PathError).Err, ShouldEqual, fs.ErrNotExist)
+			_, err = fsys.ReadDir("index.html")
+			So(err, ShouldNotBeNil)
+			_, err = fsys.ReadDir("../a")
+			So(err.(*fs.PathError).Err, ShouldEqual, fs.ErrInvalid)
+		})
+		Convey("Large directory", func() {
+			// storage returns at most ListLimit objects in single listing
+			for i := 0; i < storage.ListLimit; i++ {
+				So(m.Upload(bytes.NewBufferString(""), "c", fmt.Sprintf("a/0/%05d", i), "text/plain"), ShouldBeNil)
+			}
+			entries, err := fsys.ReadDir("a/0")
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, storage.ListLimit)
+			So(m.Upload(bytes.NewBufferString(""), "c", "a/0/last", "text/plain"), ShouldBeNil)
+			entries, err = fsys.ReadDir("a/0")
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, storage.ListLimit+1)
+			So(entries[storage.ListLimit].Name(), ShouldEqual, "last")
+		})
+		Convey("Stat", func() {
+			info, err := fsys.Stat("a/hello.txt")
+			So(err, ShouldBeNil)
+			So(info.Name(), ShouldEqual, "hello.txt")
+			So(info.Size(), ShouldEqual, 11)
+			So(info.IsDir(), ShouldBeFalse)
+			So(info.Mode(), ShouldEqual, fs.FileMode(0444))
+			So(info.Sys().(storage.ObjectInfo).Hash, ShouldEqual, "5eb63bbbe01eeed093cb22bb8f5acdc3")
+			info, err = fsys.Stat("a/b")
+			So(err, ShouldBeNil)
+			So(info.IsDir(), ShouldBeTrue)
+			So(info.Name(), ShouldEqual, "b")
+			_, err = fsys.Stat("a/missing")
+			So(err.(*fs.PathError).Err, ShouldEqual, fs.ErrNotExist)
+		})
+		Convey("Read", func() {
+			data, err := fs.ReadFile(fsys, "a/hello.txt")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello world")
+			f, err := fsys.Open("a/hello.txt")
+			So(err, ShouldBeNil)
+			defer f.Close()
+			seeker := f.(io.ReadSeeker)
+			offset, err := seeker.Seek(-5, io.SeekEnd)
+			So(err, ShouldBeNil)
+			So(offset, ShouldEqual, 6)
+			data, err = ioutil.ReadAll(seeker)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "world")
+			_, err = seeker.Seek(0, io.SeekStart)
+			So(err, ShouldBeNil)
+			data, err = ioutil.ReadAll(seeker)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello world")
+			dir, err := fsys.Open("a")
+			So(err, ShouldBeNil)
+			_, err = dir.Read(make([]byte, 1))
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Compressed", func() {
+			data := bytes.Repeat([]byte("compressed "), 1000)
+			So(m.Container("c").Upload(bytes.NewReader(data), "a/big.txt", "text/plain", storage.Compress(storage.EncodingGzip)), ShouldBeNil)
+			read, err := fs.ReadFile(fsys, "a/big.txt")
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+			info, err := fs.Stat(fsys, "a/big.txt")
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, len(data))
+		})
+		Convey("WalkDir", func() {
+			var files []string
+			err := fs.WalkDir(fsys, "a", func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					files = append(files, path)
+				}
+				return err
+			})
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{"a/b/c/deeper.txt", "a/b/deep.txt", "a/hello.txt"})
+		})
+		Convey("Template", func() {
+			tmpl, err := template.ParseFS(fsys, "templates/*.tmpl")
+			So(err, ShouldBeNil)
+			buffer := new(bytes.Buffer)
+			So(tmpl.Execute(buffer, "one"), ShouldBeNil)
+			So(buffer.String(), ShouldEqual, "page one")
+		})
+		Convey("HTTP", func() {
+			server := http.FileServer(http.FS(fsys))
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest("GET", "/a/hello.txt", nil)
+			request.Header.Set("Range", "bytes=6-")
+			server.ServeHTTP(recorder, request)
+			So(recorder.Code, ShouldEqual, http.StatusPartialContent)
+			So(recorder.Body.String(), ShouldEqual, "world")
+			recorder = httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Body.String(), ShouldContainSubstring, "<h1>index</h1>")
+		})
+	})
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// sniffLength is count of bytes, that are used by http.DetectContentType
+	sniffLength    = 512
+	defaultCharset = "utf-8"
+	octetStream    = "application/octet-stream"
+)
+
+// ContentTypes maps extensions of names, e.g. ".md" or "md", to content
+// types, that are used instead of mime.TypeByExtension and sniffing, blank
+// extension maps names without extension
+func ContentTypes(types map[string]string) TransferOption {
+	return func(t *transfer) {
+		if t.types == nil {
+			t.types = make(map[string]string)
+		}
+		for ext, contentType := range types {
+			t.types[normalizeExt(ext)] = contentType
+		}
+	}
+}
+
+// Charset sets charset of detected text types without charset, utf-8
+// by default, blank charset is not added
+func Charset(charset string) TransferOption {
+	return func(t *transfer) {
+		t.charset = charset
+	}
+}
+
+// normalizeExt returns lower case extension with leading dot
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// DetectContentType returns content type of object with name and reader
+// of all data of r. Type is found by extension in ContentTypes option,
+// then by mime.TypeByExtension and otherwise first 512 bytes of data are
+// sniffed by http.DetectContentType, as well as generic
+// application/octet-stream of extension. Read bytes are returned by seeking
+// back if r is io.Seeker, so files are returned as is.
+func DetectContentType(name string, r io.Reader, opts ...TransferOption) (string, io.Reader, error) {
+	return newTransfer(opts, SystemClock).detect(name, r)
+}
+
+// detect returns content type of data of r with name
+func (t *transfer) detect(name string, r io.Reader) (string, io.Reader, error) {
+	ext := path.Ext(name)
+	contentType, ok := t.types[normalizeExt(ext)]
+	if !ok && ext != "" {
+		contentType = mime.TypeByExtension(ext)
+	}
+	// explicit octet stream of ContentTypes is kept, only generic type
+	// of extension is refined by sniffing
+	if blank(contentType) || (!ok && contentType == octetStream) {
+		buf := make([]byte, sniffLength)
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return "", r, err
+		}
+		contentType = http.DetectContentType(buf[:n])
+		if seeker, ok := r.(io.Seeker); ok {
+			if _, err = seeker.Seek(int64(-n), io.SeekCurrent); err != nil {
+				return "", r, err
+			}
+		} else {
+			r = io.MultiReader(bytes.NewReader(buf[:n]), r)
+		}
+	}
+	return t.withCharset(contentType), r, nil
+}
+
+// withCharset adds charset to text type without charset
+func (t *transfer) withCharset(contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || blank(t.charset) || !strings.HasPrefix(mediaType, "text/") {
+		return contentType
+	}
+	if _, ok := params["charset"]; ok {
+		return contentType
+	}
+	params["charset"] = t.charset
+	return mime.FormatMediaType(mediaType, params)
+}
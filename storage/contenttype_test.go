@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	Convey("DetectContentType", t, func() {
+		detect := func(name string, data string, opts ...TransferOption) string {
+			contentType, reader, err := DetectContentType(name, strings.NewReader(data), opts...)
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(read), ShouldEqual, data)
+			return contentType
+		}
+		Convey("Extension", func() {
+			So(detect("index.html", "data"), ShouldEqual, "text/html; charset=utf-8")
+			So(detect("image.PNG", "data"), ShouldEqual, "image/png")
+		})
+		Convey("Sniffing", func() {
+			So(detect("README", "hello world"), ShouldEqual, "text/plain; charset=utf-8")
+			So(detect("page", "<!DOCTYPE html><html></html>"), ShouldEqual, "text/html; charset=utf-8")
+			So(detect("image", "\x89PNG\x0D\x0A\x1A\x0A"+strings.Repeat("\x00", 1024)), ShouldEqual, "image/png")
+			So(detect("data.unknown-ext", "\x00\x01\x02"), ShouldEqual, "application/octet-stream")
+			So(detect("empty", ""), ShouldEqual, "text/plain; charset=utf-8")
+		})
+		Convey("Types", func() {
+			types := ContentTypes(map[string]string{"md": "text/markdown", ".WASM": "application/wasm"})
+			So(detect("README.md", "# title", types), ShouldEqual, "text/markdown; charset=utf-8")
+			So(detect("app.wasm", "\x00asm", types), ShouldEqual, "application/wasm")
+			So(detect("index.html", "data", types), ShouldEqual, "text/html; charset=utf-8")
+			types = ContentTypes(map[string]string{"bin": "application/octet-stream"})
+			So(detect("data.bin", "hello world", types), ShouldEqual, "application/octet-stream")
+		})
+		Convey("Charset", func() {
+			types := ContentTypes(map[string]string{".txt": "text/plain", ".csv": "text/csv; charset=windows-1251"})
+			So(detect("a.txt", "data", types, Charset("koi8-r")), ShouldEqual, "text/plain; charset=koi8-r")
+			So(detect("a.txt", "data", types, Charset("")), ShouldEqual, "text/plain")
+			So(detect("a.csv", "data", types), ShouldEqual, "text/csv; charset=windows-1251")
+		})
+		Convey("Seeker", func() {
+			f, err := ioutil.TempFile("", "detect")
+			So(err, ShouldBeNil)
+			defer os.Remove(f.Name())
+			defer f.Close()
+			data := strings.Repeat("text ", 200)
+			f.WriteString(data)
+			f.Seek(0, io.SeekStart)
+			contentType, reader, err := DetectContentType(f.Name(), f)
+			So(err, ShouldBeNil)
+			So(contentType, ShouldEqual, "text/plain; charset=utf-8")
+			So(reader, ShouldEqual, f)
+			read, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(read), ShouldEqual, data)
+		})
+	})
+	Convey("UploadFile", t, func() {
+		dir, err := ioutil.TempDir("", "contenttype")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "LICENSE")
+		So(ioutil.WriteFile(filename, []byte("license text"), 0644), ShouldBeNil)
+		var (
+			contentType string
+			body        []byte
+		)
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			contentType = request.Header.Get(contentTypeHeader)
+			body, _ = ioutil.ReadAll(request.Body)
+			resp.StatusCode = http.StatusCreated
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		So(c.UploadFile(filename, "container"), ShouldBeNil)
+		So(contentType, ShouldEqual, "text/plain; charset=utf-8")
+		So(string(body), ShouldEqual, "license text")
+		Convey("Types", func() {
+			So(c.UploadFile(filename, "container", ContentTypes(map[string]string{"": "text/x-license"})), ShouldBeNil)
+			So(contentType, ShouldEqual, "text/x-license; charset=utf-8")
+		})
+		Convey("Upload", func() {
+			So(c.Upload(bytes.NewBufferString("%PDF-1.4"), "container", "report", ""), ShouldBeNil)
+			So(contentType, ShouldEqual, "application/pdf")
+			So(string(body), ShouldEqual, "%PDF-1.4")
+			So(c.Upload(bytes.NewBufferString("%PDF-1.4"), "container", "report", "application/x-report"), ShouldBeNil)
+			So(contentType, ShouldEqual, "application/x-report")
+		})
+	})
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"os"
+)
+
+// CredentialsProvider returns user and key for authentication, when client
+// has no credentials, e.g. was restored from token store or cache
+type CredentialsProvider interface {
+	Retrieve() (user, key string, err error)
+}
+
+// CredentialsFunc is function adapter for CredentialsProvider,
+// that can be used to read credentials from keyring or vault
+type CredentialsFunc func() (user, key string, err error)
+
+// Retrieve calls f()
+func (f CredentialsFunc) Retrieve() (user, key string, err error) {
+	return f()
+}
+
+// EnvCredentials reads credentials from EnvUser and EnvKey environmental variables
+type EnvCredentials struct{}
+
+// Retrieve returns credentials from environment or ErrorBadCredentials if they are not set
+func (EnvCredentials) Retrieve() (user, key string, err error) {
+	user, key = os.Getenv(EnvUser), os.Getenv(EnvKey)
+	if blank(user) || blank(key) {
+		return user, key, ErrorBadCredentials
+	}
+	return user, key, nil
+}
+
+// credentials returns client credentials or credentials from provider
+func (c *Client) credentials() (user, key string, err error) {
+	if (!blank(c.user) && !blank(c.key)) || c.provider == nil {
+		return c.user, c.key, nil
+	}
+	return c.provider.Retrieve()
+}
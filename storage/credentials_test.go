@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCredentialsProvider(t *testing.T) {
+	Convey("Credentials provider", t, func() {
+		Convey("Env", func() {
+			defer os.Setenv(EnvUser, os.Getenv(EnvUser))
+			defer os.Setenv(EnvKey, os.Getenv(EnvKey))
+			os.Unsetenv(EnvUser)
+			os.Unsetenv(EnvKey)
+			_, _, err := EnvCredentials{}.Retrieve()
+			So(err, ShouldEqual, ErrorBadCredentials)
+			os.Setenv(EnvUser, "user")
+			os.Setenv(EnvKey, "key")
+			user, key, err := EnvCredentials{}.Retrieve()
+			So(err, ShouldBeNil)
+			So(user, ShouldEqual, "user")
+			So(key, ShouldEqual, "key")
+		})
+		Convey("Client", func() {
+			var auths int
+			callback := func(request *http.Request) (*http.Response, error) {
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				resp.StatusCode = http.StatusNoContent
+				if request.URL.String() == "https://auth.selcdn.ru/" {
+					auths++
+					So(request.Header.Get("X-Auth-User"), ShouldEqual, "user")
+					So(request.Header.Get("X-Auth-Key"), ShouldEqual, "key")
+					resp.Header.Add("X-Expire-Auth-Token", "110")
+					resp.Header.Add("X-Auth-Token", "new")
+					resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				}
+				return resp, nil
+			}
+			expireFrom := time.Now().Add(-time.Hour)
+			cache := ClientCredentials{
+				Token:      "token",
+				URL:        "https://xxx.selcdn.ru/",
+				Expire:     110,
+				ExpireFrom: &expireFrom,
+			}
+			store := NewMemoryTokenStore()
+			So(store.Save(cache), ShouldBeNil)
+			Convey("No provider", func() {
+				api, err := NewFromStore(store, WithHTTPClient(NewTestClient(callback)))
+				So(err, ShouldBeNil)
+				So(api.RemoveObject("c", "o"), ShouldEqual, ErrorBadCredentials)
+				So(auths, ShouldEqual, 0)
+			})
+			Convey("Func", func() {
+				provider := CredentialsFunc(func() (string, string, error) {
+					return "user", "key", nil
+				})
+				api, err := NewFromStore(store, WithHTTPClient(NewTestClient(callback)), WithCredentialsProvider(provider))
+				So(err, ShouldBeNil)
+				So(api.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+				So(api.Token(), ShouldEqual, "new")
+				loaded, err := store.Load()
+				So(err, ShouldBeNil)
+				So(loaded.Token, ShouldEqual, "new")
+			})
+			Convey("Cache", func() {
+				c := newClient()
+				So(c.setCredentials(cache), ShouldBeNil)
+				data, err := c.Dump()
+				So(err, ShouldBeNil)
+				provider := CredentialsFunc(func() (string, string, error) {
+					return "user", "key", nil
+				})
+				api, err := NewFromCache(data, WithHTTPClient(NewTestClient(callback)), WithCredentialsProvider(provider))
+				So(err, ShouldBeNil)
+				So(api.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+			})
+			Convey("Error", func() {
+				errProvider := errors.New("keyring is locked")
+				provider := CredentialsFunc(func() (string, string, error) {
+					return "", "", errProvider
+				})
+				api, err := NewFromStore(store, WithHTTPClient(NewTestClient(callback)), WithCredentialsProvider(provider))
+				So(err, ShouldBeNil)
+				So(api.RemoveObject("c", "o"), ShouldEqual, errProvider)
+				So(auths, ShouldEqual, 0)
+			})
+			Convey("Own credentials", func() {
+				provider := CredentialsFunc(func() (string, string, error) {
+					return "other", "other", nil
+				})
+				c := newClient(WithHTTPClient(NewTestClient(callback)), WithCredentialsProvider(provider))
+				c.user, c.key = "user", "key"
+				So(c.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+			})
+		})
+	})
+}
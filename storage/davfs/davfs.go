@@ -0,0 +1,385 @@
+// Package davfs implements webdav.FileSystem over storage container,
+// so container can be mounted by file managers.
+//
+//	handler := &webdav.Handler{
+//		FileSystem: davfs.New(api.Container("files")),
+//		LockSystem: webdav.NewMemLS(),
+//	}
+//	http.ListenAndServe(":8080", handler)
+//
+// Directories are prefixes of object names, empty directories are kept
+// by marker objects. Files are read with ranged requests and written by
+// streaming uploads, rename is copy and delete.
+package davfs
+
+import (
+	"context"
+	"errors"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/containerfs"
+	"golang.org/x/net/webdav"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const separator = containerfs.Separator
+
+var (
+	errIsDirectory = errors.New("is a directory")
+	errWriteOnly   = errors.New("file is opened for writing")
+	errReadOnly    = errors.New("file is opened for reading")
+)
+
+// FileSystem is webdav.FileSystem of container objects
+type FileSystem struct {
+	container storage.ContainerAPI
+	fs        *containerfs.FS
+	clock     storage.Clock
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// Option configures FileSystem
+type Option func(f *FileSystem)
+
+// WithClock sets clock, that is used as modification time of files,
+// that are being written
+func WithClock(clock storage.Clock) Option {
+	return func(f *FileSystem) {
+		f.clock = clock
+	}
+}
+
+// New returns file system of container
+func New(container storage.ContainerAPI, opts ...Option) *FileSystem {
+	f := &FileSystem{
+		container: container,
+		fs:        containerfs.New(container),
+		clock:     storage.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// clean returns object name of webdav path, root is "."
+func clean(name string) string {
+	name = strings.Trim(path.Clean("/"+name), separator)
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Mkdir creates marker object of directory, parent directory must exist
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = clean(name)
+	if name == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if _, err := f.fs.Stat(name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	if err := f.parent("mkdir", name); err != nil {
+		return err
+	}
+	return f.container.Upload(strings.NewReader(""), name+separator, containerfs.DirectoryContentType)
+}
+
+// parent returns error if parent directory of name does not exist
+func (f *FileSystem) parent(op, name string) error {
+	info, err := f.fs.Stat(path.Dir(name))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return nil
+}
+
+// OpenFile opens file for reading or for writing, that is streamed
+// to container until file is closed
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = clean(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		file, err := f.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &readFile{File: file, name: name}, nil
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDirectory}
+	}
+	info, err := f.fs.Stat(name)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDirectory}
+	case err == nil && flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if err = f.parent("open", name); err != nil {
+		return nil, err
+	}
+	return f.create(name), nil
+}
+
+// create starts streaming upload of object
+func (f *FileSystem) create(name string) *writeFile {
+	reader, writer := io.Pipe()
+	file := &writeFile{name: name, writer: writer, done: make(chan struct{}), modified: f.clock.Now()}
+	go func() {
+		// type is detected by extension or by first written bytes
+		err := f.container.Upload(reader, name, "")
+		reader.CloseWithError(err)
+		file.err = err
+		close(file.done)
+	}()
+	return file
+}
+
+// RemoveAll removes object or all objects of directory
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+	if name == "." {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrInvalid}
+	}
+	objects, err := f.objects(name)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := f.container.RemoveObject(object.Name); err != nil && err != storage.ErrorObjectNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// objects returns object with name or objects of directory with name,
+// including markers
+func (f *FileSystem) objects(name string) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	info, err := f.container.ObjectInfo(name)
+	switch {
+	case err == nil && info.ContentType != containerfs.DirectoryContentType:
+		return []storage.ObjectInfo{info}, nil
+	case err == nil:
+		objects = append(objects, info)
+	case err != storage.ErrorObjectNotFound:
+		return nil, err
+	}
+	children, err := storage.AllObjectsInfo(f.container, storage.Prefix(name+separator))
+	if err != nil {
+		return nil, err
+	}
+	return append(objects, children...), nil
+}
+
+// Rename copies object or all objects of directory to new name and
+// removes them
+func (f *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = clean(oldName), clean(newName)
+	if oldName == "." || newName == "." || strings.HasPrefix(newName+separator, oldName+separator) {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrInvalid}
+	}
+	if _, err := f.fs.Stat(newName); err == nil {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrExist}
+	}
+	if err := f.parent("rename", newName); err != nil {
+		return err
+	}
+	objects, err := f.objects(oldName)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	for _, object := range objects {
+		if err := f.copy(object, newName+strings.TrimPrefix(object.Name, oldName)); err != nil {
+			return err
+		}
+	}
+	for _, object := range objects {
+		if err := f.container.RemoveObject(object.Name); err != nil && err != storage.ErrorObjectNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy streams object to object with name, metadata, e.g. wrapped keys
+// of encrypted objects, and compression are kept
+func (f *FileSystem) copy(object storage.ObjectInfo, name string) error {
+	info, err := f.container.ObjectInfo(object.Name)
+	if err != nil {
+		return err
+	}
+	var opts []storage.TransferOption
+	for key, value := range info.Metadata {
+		opts = append(opts, storage.Metadata(key, value))
+	}
+	if info.ContentEncoding == storage.EncodingGzip || info.ContentEncoding == storage.EncodingZstd {
+		// data is decompressed by GetReader
+		opts = append(opts, storage.Compress(info.ContentEncoding))
+	}
+	reader, err := f.container.Object(object.Name).GetReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return f.container.Upload(reader, name, info.ContentType, opts...)
+}
+
+// Stat returns info of object or directory
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := f.fs.Stat(clean(name))
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info}, nil
+}
+
+// fileInfo is os.FileInfo with etag and content type of object
+type fileInfo struct {
+	os.FileInfo
+}
+
+// ETag returns hash of object
+func (i fileInfo) ETag(ctx context.Context) (string, error) {
+	object, ok := i.Sys().(storage.ObjectInfo)
+	if !ok || i.IsDir() || object.Hash == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + object.Hash + `"`, nil
+}
+
+// ContentType returns content type of object
+func (i fileInfo) ContentType(ctx context.Context) (string, error) {
+	object, ok := i.Sys().(storage.ObjectInfo)
+	if !ok || i.IsDir() || object.ContentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return object.ContentType, nil
+}
+
+// readFile is file or directory, that is opened for reading
+type readFile struct {
+	fs.File
+	name string
+}
+
+func (f *readFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{info}, nil
+}
+
+// Seek is supported by files, that are read with ranged requests
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errIsDirectory}
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// Readdir returns count of entries or all entries if count <= 0
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	dir, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+	}
+	entries, err := dir.ReadDir(count)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, fileInfo{info})
+	}
+	return infos, err
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+// writeFile streams written data to upload, that ends on Close
+type writeFile struct {
+	name     string
+	writer   *io.PipeWriter
+	done     chan struct{}
+	err      error
+	mu       sync.Mutex
+	size     int64
+	modified time.Time
+	closed   bool
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	n, err := f.writer.Write(p)
+	f.mu.Lock()
+	f.size += int64(n)
+	f.mu.Unlock()
+	return n, err
+}
+
+// Close finishes upload and returns its error
+func (f *writeFile) Close() error {
+	f.mu.Lock()
+	closed := f.closed
+	f.closed = true
+	f.mu.Unlock()
+	if !closed {
+		f.writer.Close()
+	}
+	<-f.done
+	return f.err
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errWriteOnly}
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errWriteOnly}
+}
+
+func (f *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.New("not a directory")}
+}
+
+// Stat returns info of data, that is written
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &writtenInfo{name: path.Base(f.name), size: f.size, modified: f.modified}, nil
+}
+
+// writtenInfo is os.FileInfo of file, that is being written
+type writtenInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+}
+
+func (i *writtenInfo) Name() string       { return i.name }
+func (i *writtenInfo) Size() int64        { return i.size }
+func (i *writtenInfo) Mode() os.FileMode  { return 0644 }
+func (i *writtenInfo) ModTime() time.Time { return i.modified }
+func (i *writtenInfo) IsDir() bool        { return false }
+func (i *writtenInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,198 @@
+package davfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/containerfs"
+	"github.com/ernado/selectel/storage/encrypted"
+	"github.com/ernado/selectel/storage/storagetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/webdav"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileSystem(t *testing.T) {
+	Convey("FileSystem", t, func() {
+		ctx := context.Background()
+		m := storagetest.NewMemory()
+		container, err := m.CreateContainer("c", false)
+		So(err, ShouldBeNil)
+		for name, data := range map[string]string{
+			"a/hello.txt":  "hello world",
+			"a/b/deep.txt": "deep",
+			"root.txt":     "root",
+		} {
+			So(container.Upload(bytes.NewBufferString(data), name, "text/plain"), ShouldBeNil)
+		}
+		now := time.Date(2013, time.May, 21, 12, 27, 11, 0, time.UTC)
+		fsys := New(container, WithClock(storagetest.NewFakeClock(now)))
+		read := func(name string) string {
+			f, err := fsys.OpenFile(ctx, name, os.O_RDONLY, 0)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			data, err := ioutil.ReadAll(f)
+			So(err, ShouldBeNil)
+			return string(data)
+		}
+		names := func(name string) []string {
+			f, err := fsys.OpenFile(ctx, name, os.O_RDONLY, 0)
+			So(err, ShouldBeNil)
+			defer f.Close()
+			infos, err := f.Readdir(0)
+			So(err, ShouldBeNil)
+			var result []string
+			for _, info := range infos {
+				result = append(result, info.Name())
+			}
+			return result
+		}
+
+		Convey("Read", func() {
+			So(read("/a/hello.txt"), ShouldEqual, "hello world")
+			So(names("/"), ShouldResemble, []string{"a", "root.txt"})
+			So(names("/a/"), ShouldResemble, []string{"b", "hello.txt"})
+			f, err := fsys.OpenFile(ctx, "/a/hello.txt", os.O_RDONLY, 0)
+			So(err, ShouldBeNil)
+			_, err = f.Seek(6, io.SeekStart)
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(f)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "world")
+			_, err = f.Write([]byte("x"))
+			So(err, ShouldNotBeNil)
+			So(f.Close(), ShouldBeNil)
+			_, err = fsys.OpenFile(ctx, "/missing", os.O_RDONLY, 0)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+		Convey("Stat", func() {
+			info, err := fsys.Stat(ctx, "/a/hello.txt")
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, 11)
+			etag, err := info.(webdav.ETager).ETag(ctx)
+			So(err, ShouldBeNil)
+			So(etag, ShouldEqual, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`)
+			contentType, err := info.(webdav.ContentTyper).ContentType(ctx)
+			So(err, ShouldBeNil)
+			So(contentType, ShouldEqual, "text/plain")
+			info, err = fsys.Stat(ctx, "/a")
+			So(err, ShouldBeNil)
+			So(info.IsDir(), ShouldBeTrue)
+			_, err = info.(webdav.ETager).ETag(ctx)
+			So(err, ShouldEqual, webdav.ErrNotImplemented)
+			_, err = fsys.Stat(ctx, "/missing")
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+		Convey("Write", func() {
+			f, err := fsys.OpenFile(ctx, "/a/new.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+			So(err, ShouldBeNil)
+			_, err = io.Copy(f, bytes.NewBufferString("streamed "))
+			So(err, ShouldBeNil)
+			_, err = f.Write([]byte("data"))
+			So(err, ShouldBeNil)
+			info, err := f.Stat()
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, 13)
+			So(info.Name(), ShouldEqual, "new.txt")
+			So(info.ModTime(), ShouldResemble, now)
+			_, err = f.Read(make([]byte, 1))
+			So(err, ShouldNotBeNil)
+			So(f.Close(), ShouldBeNil)
+			So(read("/a/new.txt"), ShouldEqual, "streamed data")
+			object, err := container.ObjectInfo("a/new.txt")
+			So(err, ShouldBeNil)
+			So(object.ContentType, ShouldStartWith, "text/plain")
+
+			_, err = fsys.OpenFile(ctx, "/a/new.txt", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+			So(os.IsExist(err), ShouldBeTrue)
+			_, err = fsys.OpenFile(ctx, "/missing/new.txt", os.O_RDWR|os.O_CREATE, 0666)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = fsys.OpenFile(ctx, "/other.txt", os.O_WRONLY, 0666)
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = fsys.OpenFile(ctx, "/a", os.O_WRONLY, 0666)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("Mkdir", func() {
+			So(fsys.Mkdir(ctx, "/empty", 0755), ShouldBeNil)
+			info, err := fsys.Stat(ctx, "/empty/")
+			So(err, ShouldBeNil)
+			So(info.IsDir(), ShouldBeTrue)
+			So(names("/"), ShouldResemble, []string{"a", "empty", "root.txt"})
+			So(names("/empty"), ShouldBeEmpty)
+			_, err = container.ObjectInfo("empty/")
+			So(err, ShouldBeNil)
+			So(os.IsExist(fsys.Mkdir(ctx, "/empty", 0755)), ShouldBeTrue)
+			So(os.IsExist(fsys.Mkdir(ctx, "/a", 0755)), ShouldBeTrue)
+			So(os.IsNotExist(fsys.Mkdir(ctx, "/missing/dir", 0755)), ShouldBeTrue)
+			So(fsys.Mkdir(ctx, "/empty/nested", 0755), ShouldBeNil)
+			So(names("/empty"), ShouldResemble, []string{"nested"})
+		})
+		Convey("Rename", func() {
+			So(fsys.Rename(ctx, "/root.txt", "/a/moved.txt"), ShouldBeNil)
+			So(read("/a/moved.txt"), ShouldEqual, "root")
+			_, err := fsys.Stat(ctx, "/root.txt")
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			So(fsys.Mkdir(ctx, "/a/b/empty", 0755), ShouldBeNil)
+			So(fsys.Rename(ctx, "/a", "/c"), ShouldBeNil)
+			So(names("/"), ShouldResemble, []string{"c"})
+			So(read("/c/b/deep.txt"), ShouldEqual, "deep")
+			So(names("/c/b"), ShouldResemble, []string{"deep.txt", "empty"})
+			objects, err := container.ObjectsInfo()
+			So(err, ShouldBeNil)
+			So(objects, ShouldHaveLength, 4)
+
+			So(os.IsNotExist(fsys.Rename(ctx, "/missing", "/x")), ShouldBeTrue)
+			So(os.IsExist(fsys.Rename(ctx, "/c/hello.txt", "/c/moved.txt")), ShouldBeTrue)
+			So(fsys.Rename(ctx, "/c", "/c/b/inside"), ShouldNotBeNil)
+			So(fsys.Rename(ctx, "/", "/x"), ShouldNotBeNil)
+		})
+		Convey("Rename encrypted", func() {
+			encryptedContainer, err := encrypted.New(container, bytes.Repeat([]byte{1}, 32))
+			So(err, ShouldBeNil)
+			So(encryptedContainer.Upload(bytes.NewBufferString("secret"), "secret.txt", "text/plain",
+				storage.Compress(storage.EncodingGzip)), ShouldBeNil)
+			So(fsys.Rename(ctx, "/secret.txt", "/moved.txt"), ShouldBeNil)
+			info, err := container.ObjectInfo("moved.txt")
+			So(err, ShouldBeNil)
+			So(info.ContentEncoding, ShouldEqual, storage.EncodingGzip)
+			So(info.Metadata[encrypted.DataKeyKey], ShouldNotBeEmpty)
+			data, err := encryptedContainer.Object("moved.txt").Download()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "secret")
+		})
+		Convey("RemoveAll", func() {
+			So(fsys.Mkdir(ctx, "/a/b/empty", 0755), ShouldBeNil)
+			So(fsys.RemoveAll(ctx, "/a/b"), ShouldBeNil)
+			So(names("/a"), ShouldResemble, []string{"hello.txt"})
+			So(fsys.RemoveAll(ctx, "/root.txt"), ShouldBeNil)
+			So(fsys.RemoveAll(ctx, "/missing"), ShouldBeNil)
+			So(names("/"), ShouldResemble, []string{"a"})
+			So(fsys.RemoveAll(ctx, "/"), ShouldNotBeNil)
+		})
+		Convey("RemoveAll large directory", func() {
+			// storage returns at most ListLimit objects in single listing
+			for i := 0; i <= storage.ListLimit; i++ {
+				So(container.Upload(bytes.NewBufferString(""), fmt.Sprintf("a/large/%05d", i), "text/plain"), ShouldBeNil)
+			}
+			So(fsys.RemoveAll(ctx, "/a/large"), ShouldBeNil)
+			objects, err := container.ObjectsInfo(storage.Prefix("a/large/"))
+			So(err, ShouldBeNil)
+			So(objects, ShouldBeEmpty)
+		})
+		Convey("Directory marker", func() {
+			So(container.Upload(bytes.NewBufferString(""), "marker", containerfs.DirectoryContentType), ShouldBeNil)
+			info, err := fsys.Stat(ctx, "/marker")
+			So(err, ShouldBeNil)
+			So(info.IsDir(), ShouldBeTrue)
+			So(fsys.RemoveAll(ctx, "/marker"), ShouldBeNil)
+			_, err = container.ObjectInfo("marker")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,482 @@
+// Package dirsync synchronizes local directory with objects of container,
+// files are compared with objects by size and md5, that is etag of object.
+//
+//	syncer := dirsync.New("public", api.Container("site"),
+//		dirsync.WithPrefix("v2/"), dirsync.WithDelete(true))
+//	actions, err := syncer.Run()
+//
+// Direction Up uploads changed files, Down downloads changed objects and
+// Mirror copies missing files both ways and resolves changes by
+// modification time. Removal of files or objects, that are missing on
+// other side, is enabled by WithDelete and is not supported by Mirror.
+// Uploaded objects keep md5 of files in metadata, so compressed objects
+// are compared with files too.
+package dirsync
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/containerfs"
+	"github.com/ernado/selectel/storage/internal/batch"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Direction is direction of synchronization
+type Direction int
+
+const (
+	// Up uploads local files to container
+	Up Direction = iota
+	// Down downloads objects of container to directory
+	Down
+	// Mirror copies files and objects both ways
+	Mirror
+)
+
+// HashKey is metadata key of md5 of uploaded file, objects, that are
+// stored with other size or etag, e.g. compressed ones, are compared by it
+const HashKey = "Sync-Md5"
+
+var directions = map[string]Direction{"up": Up, "down": Down, "mirror": Mirror}
+
+func (d Direction) String() string {
+	for name, direction := range directions {
+		if direction == d {
+			return name
+		}
+	}
+	return fmt.Sprintf("Direction(%d)", int(d))
+}
+
+// ParseDirection returns direction by name: up, down or mirror
+func ParseDirection(s string) (Direction, error) {
+	d, ok := directions[s]
+	if !ok {
+		return Up, ErrorBadDirection
+	}
+	return d, nil
+}
+
+var (
+	// ErrorBadDirection is returned for unknown direction
+	ErrorBadDirection = errors.New("Bad direction, expected up, down or mirror")
+	// ErrorMirrorDelete is returned when delete is enabled for Mirror
+	ErrorMirrorDelete = errors.New("Delete is not supported in mirror direction")
+	// ErrorFailed is returned by Run if some actions failed
+	ErrorFailed = errors.New("Some sync actions failed")
+)
+
+// Operation is kind of Action
+type Operation string
+
+const (
+	// Upload uploads file to object
+	Upload Operation = "upload"
+	// Download downloads object to file
+	Download Operation = "download"
+	// RemoveObject removes object, that has no file
+	RemoveObject Operation = "remove object"
+	// RemoveFile removes file, that has no object
+	RemoveFile Operation = "remove file"
+)
+
+// Action is single operation of synchronization
+type Action struct {
+	Operation Operation
+	// Name is path relative to directory and prefix, separated by slash
+	Name string
+	// Object is name of object in container
+	Object string
+	// Path is path of local file
+	Path string
+	// Size is size of transferred data
+	Size int64
+	// Err is error of executed action
+	Err error
+}
+
+func (a Action) String() string {
+	return string(a.Operation) + " " + a.Name
+}
+
+// Syncer synchronizes directory with container
+type Syncer struct {
+	dir         string
+	container   storage.ContainerAPI
+	direction   Direction
+	prefix      string
+	remove      bool
+	include     []string
+	exclude     []string
+	dryRun      bool
+	concurrency int
+	report      func(Action)
+	transfer    []storage.TransferOption
+}
+
+// Option configures Syncer
+type Option func(s *Syncer)
+
+// WithDirection sets direction of synchronization, Up by default
+func WithDirection(d Direction) Option {
+	return func(s *Syncer) {
+		s.direction = d
+	}
+}
+
+// WithPrefix synchronizes directory with objects, that have names with
+// prefix, slash is added to not empty prefix
+func WithPrefix(prefix string) Option {
+	return func(s *Syncer) {
+		s.prefix = prefix
+		if prefix != "" && !strings.HasSuffix(prefix, containerfs.Separator) {
+			s.prefix += containerfs.Separator
+		}
+	}
+}
+
+// WithDelete removes files or objects, that are missing on source side
+func WithDelete(remove bool) Option {
+	return func(s *Syncer) {
+		s.remove = remove
+	}
+}
+
+// WithInclude synchronizes only names, that match one of glob patterns,
+// patterns are matched with name, its directories and their base names
+func WithInclude(patterns ...string) Option {
+	return func(s *Syncer) {
+		s.include = append(s.include, patterns...)
+	}
+}
+
+// WithExclude skips names, that match one of glob patterns
+func WithExclude(patterns ...string) Option {
+	return func(s *Syncer) {
+		s.exclude = append(s.exclude, patterns...)
+	}
+}
+
+// WithDryRun only reports actions, that would be executed
+func WithDryRun(dryRun bool) Option {
+	return func(s *Syncer) {
+		s.dryRun = dryRun
+	}
+}
+
+// WithConcurrency sets count of actions, that are executed in parallel
+func WithConcurrency(n int) Option {
+	return func(s *Syncer) {
+		s.concurrency = n
+	}
+}
+
+// WithReport calls f for every executed action or for planned action in
+// dry run mode, f can be called concurrently
+func WithReport(f func(Action)) Option {
+	return func(s *Syncer) {
+		s.report = f
+	}
+}
+
+// WithUploadOptions sets transfer options of uploads, e.g.
+// storage.ContentTypes, that is used for detection of content types
+func WithUploadOptions(opts ...storage.TransferOption) Option {
+	return func(s *Syncer) {
+		s.transfer = append(s.transfer, opts...)
+	}
+}
+
+// New returns Syncer of directory and container
+func New(dir string, container storage.ContainerAPI, opts ...Option) *Syncer {
+	s := &Syncer{dir: dir, container: container, concurrency: 1}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.concurrency < 1 {
+		s.concurrency = 1
+	}
+	return s
+}
+
+// file is local file or object with relative name
+type file struct {
+	size     int64
+	hash     string
+	path     string
+	modified time.Time
+}
+
+// match returns true if name is included and is not excluded, pattern,
+// that matches directory, matches all names in it
+func (s *Syncer) match(name string) bool {
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			for p := name; p != "."; p = path.Dir(p) {
+				if ok, _ := path.Match(pattern, p); ok {
+					return true
+				}
+				if ok, _ := path.Match(pattern, path.Base(p)); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return (len(s.include) == 0 || matches(s.include)) && !matches(s.exclude)
+}
+
+// local returns regular files of directory by relative names
+func (s *Syncer) local() (map[string]*file, error) {
+	files := make(map[string]*file)
+	if _, err := os.Lstat(s.dir); os.IsNotExist(err) && s.direction != Up {
+		// directory is created by download
+		return files, nil
+	}
+	err := batch.Files(s.dir, func(name, p string, info fs.FileInfo) error {
+		if s.match(name) {
+			files[name] = &file{size: info.Size(), path: p, modified: info.ModTime()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// remote returns objects with prefix by relative names, directory markers
+// and names, that are not valid paths, are skipped. All pages of listing
+// are read, so objects are not missing in large containers
+func (s *Syncer) remote() (map[string]*file, error) {
+	objects, err := storage.AllObjectsInfo(s.container, storage.Prefix(s.prefix))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*file)
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Name, s.prefix)
+		if object.ContentType == containerfs.DirectoryContentType || !fs.ValidPath(name) || name == "." || !s.match(name) {
+			continue
+		}
+		files[name] = &file{size: int64(object.Size), hash: object.Hash, modified: object.LastModified}
+	}
+	return files, nil
+}
+
+// hashFile returns md5 of file
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := md5.New()
+	if _, err = io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// equal returns true if file has size and md5 of object in listing or,
+// e.g. for compressed object, size and md5 of object metadata
+func (s *Syncer) equal(name string, local, remote *file) (bool, error) {
+	var hash string
+	if local.size == remote.size {
+		var err error
+		if hash, err = hashFile(local.path); err != nil {
+			return false, err
+		}
+		if hash == strings.Trim(remote.hash, `"`) {
+			return true, nil
+		}
+	}
+	info, err := s.container.ObjectInfo(s.prefix + name)
+	if err != nil {
+		return false, err
+	}
+	if blank(info.Metadata[HashKey]) || int64(info.Size) != local.size {
+		return false, nil
+	}
+	if blank(hash) {
+		if hash, err = hashFile(local.path); err != nil {
+			return false, err
+		}
+	}
+	return info.Metadata[HashKey] == hash, nil
+}
+
+func blank(s string) bool {
+	return len(s) == 0
+}
+
+// Plan compares directory with container and returns actions sorted by
+// name, that make them equal. Nothing is planned if listing of container
+// fails or is incomplete, so files are not removed as missing objects
+func (s *Syncer) Plan() ([]Action, error) {
+	if s.direction == Mirror && s.remove {
+		return nil, ErrorMirrorDelete
+	}
+	if s.direction < Up || s.direction > Mirror {
+		return nil, ErrorBadDirection
+	}
+	local, err := s.local()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := s.remote()
+	if err != nil {
+		return nil, err
+	}
+	var actions []Action
+	add := func(operation Operation, name string, size int64) {
+		actions = append(actions, Action{
+			Operation: operation,
+			Name:      name,
+			Object:    s.prefix + name,
+			Path:      filepath.Join(s.dir, filepath.FromSlash(name)),
+			Size:      size,
+		})
+	}
+	for name, l := range local {
+		r, ok := remote[name]
+		switch {
+		case !ok && s.direction == Down && s.remove:
+			add(RemoveFile, name, 0)
+		case !ok && s.direction != Down:
+			add(Upload, name, l.size)
+		case !ok:
+		default:
+			same, err := s.equal(name, l, r)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case same:
+			case s.direction == Up, s.direction == Mirror && !r.modified.After(l.modified):
+				add(Upload, name, l.size)
+			default:
+				add(Download, name, r.size)
+			}
+		}
+	}
+	for name, r := range remote {
+		if _, ok := local[name]; ok {
+			continue
+		}
+		switch {
+		case s.direction == Up && s.remove:
+			add(RemoveObject, name, 0)
+		case s.direction != Up:
+			add(Download, name, r.size)
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Name < actions[j].Name
+	})
+	return actions, nil
+}
+
+// Run executes planned actions by workers and returns them with errors,
+// ErrorFailed is returned if some of actions failed. Actions are only
+// reported in dry run mode
+func (s *Syncer) Run() ([]Action, error) {
+	actions, err := s.Plan()
+	if err != nil {
+		return nil, err
+	}
+	if s.dryRun {
+		for _, action := range actions {
+			s.done(action)
+		}
+		return actions, nil
+	}
+	batch.Run(s.concurrency, len(actions), func(i int) {
+		actions[i].Err = s.execute(actions[i])
+		s.done(actions[i])
+	})
+	for _, action := range actions {
+		if action.Err != nil {
+			return actions, ErrorFailed
+		}
+	}
+	return actions, nil
+}
+
+func (s *Syncer) done(action Action) {
+	if s.report != nil {
+		s.report(action)
+	}
+}
+
+// execute executes single action
+func (s *Syncer) execute(action Action) error {
+	switch action.Operation {
+	case Upload:
+		f, err := os.Open(action.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash, err := hashFile(action.Path)
+		if err != nil {
+			return err
+		}
+		opts := append([]storage.TransferOption{storage.Metadata(HashKey, hash)}, s.transfer...)
+		return s.container.Upload(f, action.Object, "", opts...)
+	case Download:
+		return s.download(action)
+	case RemoveObject:
+		return s.container.RemoveObject(action.Object)
+	case RemoveFile:
+		return os.Remove(action.Path)
+	}
+	return fmt.Errorf("unknown operation %q", action.Operation)
+}
+
+// download writes object to temporary file, that replaces file, and sets
+// modification time of object to file, so it is not uploaded back by Mirror
+func (s *Syncer) download(action Action) error {
+	info, err := s.container.ObjectInfo(action.Object)
+	if err != nil {
+		return err
+	}
+	reader, err := s.container.Object(action.Object).GetReader()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	dir := filepath.Dir(action.Path)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(action.Path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = f.Chmod(0644); err == nil {
+		_, err = io.Copy(f, reader)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), action.Path); err != nil {
+		return err
+	}
+	if info.LastModified.IsZero() {
+		return nil
+	}
+	return os.Chtimes(action.Path, info.LastModified, info.LastModified)
+}
@@ -0,0 +1,205 @@
+package dirsync
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/containerfs"
+	"github.com/ernado/selectel/storage/storagetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSyncer(t *testing.T) {
+	Convey("Syncer", t, func() {
+		dir, err := ioutil.TempDir("", "dirsync")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		m := storagetest.NewMemory()
+		container, err := m.CreateContainer("c", false)
+		So(err, ShouldBeNil)
+		write := func(name, data string) {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			So(os.MkdirAll(filepath.Dir(p), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(p, []byte(data), 0644), ShouldBeNil)
+		}
+		read := func(name string) string {
+			data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+			So(err, ShouldBeNil)
+			return string(data)
+		}
+		download := func(name string) string {
+			data, err := container.Object(name).Download()
+			So(err, ShouldBeNil)
+			return string(data)
+		}
+		operations := func(actions []Action) []string {
+			var result []string
+			for _, action := range actions {
+				result = append(result, action.String())
+			}
+			return result
+		}
+		write("index.html", "<h1>index</h1>")
+		write("css/site.css", "body {}")
+		write("tmp/cache.bin", "cache")
+
+		Convey("Content types", func() {
+			write("notes.md", "# notes")
+			write("LICENSE", "license text")
+			s := New(dir, container, WithInclude("notes.md", "LICENSE"),
+				WithUploadOptions(storage.ContentTypes(map[string]string{"md": "text/markdown"})))
+			_, err := s.Run()
+			So(err, ShouldBeNil)
+			info, err := container.ObjectInfo("notes.md")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldEqual, "text/markdown; charset=utf-8")
+			info, err = container.ObjectInfo("LICENSE")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldEqual, "text/plain; charset=utf-8")
+		})
+		Convey("Up", func() {
+			var (
+				mu       sync.Mutex
+				reported []Action
+			)
+			s := New(dir, container, WithPrefix("site"), WithExclude("tmp/*"), WithConcurrency(4), WithReport(func(a Action) {
+				mu.Lock()
+				reported = append(reported, a)
+				mu.Unlock()
+			}))
+			actions, err := s.Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"upload css/site.css", "upload index.html"})
+			So(reported, ShouldHaveLength, 2)
+			So(download("site/css/site.css"), ShouldEqual, "body {}")
+			info, err := container.ObjectInfo("site/index.html")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldStartWith, "text/html")
+
+			actions, err = s.Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+
+			write("index.html", "<h1>changed</h1>")
+			So(container.Upload(bytes.NewBufferString("old"), "site/old.txt", "text/plain"), ShouldBeNil)
+			actions, err = New(dir, container, WithPrefix("site/"), WithExclude("tmp/*"), WithDelete(true), WithDryRun(true)).Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"upload index.html", "remove object old.txt"})
+			So(download("site/index.html"), ShouldEqual, "<h1>index</h1>")
+
+			actions, err = New(dir, container, WithPrefix("site/"), WithExclude("tmp/*"), WithDelete(true)).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldHaveLength, 2)
+			So(download("site/index.html"), ShouldEqual, "<h1>changed</h1>")
+			_, err = container.ObjectInfo("site/old.txt")
+			So(err, ShouldEqual, storage.ErrorObjectNotFound)
+		})
+		Convey("Pages", func() {
+			actions, err := New(dir, container).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldHaveLength, 3)
+			// objects of first page are listed before files
+			for i := 0; i < storage.ListLimit; i++ {
+				So(container.Upload(bytes.NewBufferString(""), fmt.Sprintf("a/%05d", i), "text/plain"), ShouldBeNil)
+			}
+			actions, err = New(dir, container, WithDirection(Down), WithDelete(true), WithExclude("a")).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+			So(read("tmp/cache.bin"), ShouldEqual, "cache")
+			actions, err = New(dir, container, WithExclude("a")).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+		})
+		Convey("Compressed", func() {
+			s := New(dir, container, WithExclude("tmp"), WithUploadOptions(storage.Compress(storage.EncodingGzip)))
+			actions, err := s.Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldHaveLength, 2)
+			info, err := container.ObjectInfo("index.html")
+			So(err, ShouldBeNil)
+			So(info.ContentEncoding, ShouldEqual, storage.EncodingGzip)
+			So(info.Metadata[HashKey], ShouldEqual, "5aff436637514c6691d075b6d65f8f68")
+			actions, err = s.Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+			actions, err = New(dir, container, WithDirection(Mirror), WithExclude("tmp")).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+			write("index.html", "<h1>changed</h1>")
+			actions, err = s.Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"upload index.html"})
+		})
+		Convey("Include", func() {
+			actions, err := New(dir, container, WithInclude("*.css")).Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"upload css/site.css"})
+		})
+		Convey("Down", func() {
+			So(container.Upload(bytes.NewBufferString("remote"), "a/b/remote.txt", "text/plain"), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString("changed"), "index.html", "text/html"), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString(""), "empty", containerfs.DirectoryContentType), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString("bad"), "../bad", "text/plain"), ShouldBeNil)
+			actions, err := New(dir, container, WithDirection(Down), WithDelete(true), WithExclude("tmp")).Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"download a/b/remote.txt", "remove file css/site.css", "download index.html"})
+			So(read("a/b/remote.txt"), ShouldEqual, "remote")
+			So(read("index.html"), ShouldEqual, "changed")
+			So(read("tmp/cache.bin"), ShouldEqual, "cache")
+			_, err = os.Stat(filepath.Join(dir, "css", "site.css"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			target := filepath.Join(dir, "new")
+			actions, err = New(target, container, WithDirection(Down)).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldHaveLength, 2)
+		})
+		Convey("Mirror", func() {
+			So(container.Upload(bytes.NewBufferString("remote"), "remote.txt", "text/plain"), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString("newer"), "index.html", "text/html"), ShouldBeNil)
+			old := time.Now().Add(-time.Hour)
+			So(os.Chtimes(filepath.Join(dir, "index.html"), old, old), ShouldBeNil)
+			actions, err := New(dir, container, WithDirection(Mirror), WithExclude("tmp/*")).Run()
+			So(err, ShouldBeNil)
+			So(operations(actions), ShouldResemble, []string{"upload css/site.css", "download index.html", "download remote.txt"})
+			So(read("index.html"), ShouldEqual, "newer")
+			So(download("css/site.css"), ShouldEqual, "body {}")
+
+			actions, err = New(dir, container, WithDirection(Mirror), WithExclude("tmp/*")).Run()
+			So(err, ShouldBeNil)
+			So(actions, ShouldBeEmpty)
+
+			_, err = New(dir, container, WithDirection(Mirror), WithDelete(true)).Run()
+			So(err, ShouldEqual, ErrorMirrorDelete)
+		})
+		Convey("Failed", func() {
+			actions, err := New(dir, m.Container("missing")).Run()
+			So(err, ShouldNotBeNil)
+			So(actions, ShouldBeNil)
+			So(os.Chmod(filepath.Join(dir, "index.html"), 0), ShouldBeNil)
+			defer os.Chmod(filepath.Join(dir, "index.html"), 0644)
+			if f, err := os.Open(filepath.Join(dir, "index.html")); err == nil {
+				// permissions are not checked for root
+				f.Close()
+				return
+			}
+			actions, err = New(dir, container).Run()
+			So(err, ShouldEqual, ErrorFailed)
+			So(actions[1].Err, ShouldNotBeNil)
+		})
+		Convey("Direction", func() {
+			d, err := ParseDirection("mirror")
+			So(err, ShouldBeNil)
+			So(d, ShouldEqual, Mirror)
+			So(d.String(), ShouldEqual, "mirror")
+			_, err = ParseDirection("sideways")
+			So(err, ShouldEqual, ErrorBadDirection)
+		})
+	})
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sensitiveHeaders are headers, that are redacted in dumps
+var sensitiveHeaders = []string{
+	authTokenHeader, authKeyHeader, "X-Storage-Token", "X-Subject-Token",
+}
+
+// WithDump enables wire dump mode, every request is written to w as curl
+// command, that reproduces it, followed by response status and headers.
+// Bodies are dumped up to bodyLimit bytes, zero disables bodies. Tokens,
+// keys and signatures are redacted, bodies of authentication requests
+// are never dumped.
+func WithDump(w io.Writer, bodyLimit int64) Option {
+	return func(c *Client) {
+		c.dump = &dumper{w: w, limit: bodyLimit}
+	}
+}
+
+// dumper writes requests and responses, entries are not interleaved
+type dumper struct {
+	mu    sync.Mutex
+	w     io.Writer
+	limit int64
+}
+
+func (d *dumper) write(entry *bytes.Buffer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Write(entry.Bytes())
+}
+
+// dumpInterceptor writes requests and responses if dump mode is enabled
+func (c *Client) dumpInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		if c.dump == nil {
+			return next.Do(request)
+		}
+		operation := RequestOperation(request)
+		entry := new(bytes.Buffer)
+		fmt.Fprintf(entry, "# %s %s attempt %d\n",
+			c.clock.Now().Format(time.RFC3339Nano), operation, attempt(request))
+		var (
+			body  []byte
+			whole bool
+			err   error
+		)
+		if request.Body != nil && request.Body != http.NoBody && operation != OperationAuth {
+			if body, whole, request.Body, err = peek(request.Body, c.dump.limit); err != nil {
+				return nil, err
+			}
+		}
+		writeCurl(entry, request, body, whole)
+
+		res, err := next.Do(request)
+		if err != nil {
+			fmt.Fprintf(entry, "# error: %s\n\n", err)
+			c.dump.write(entry)
+			return nil, err
+		}
+		fmt.Fprintf(entry, "< %s %s\n", res.Proto, res.Status)
+		writeHeaders(entry, "< ", res.Header)
+		body = nil
+		if res.Body != nil && request.Method != headMethod && operation != OperationAuth {
+			if body, whole, res.Body, err = peek(res.Body, c.dump.limit); err != nil {
+				fmt.Fprintf(entry, "# error: %s\n\n", err)
+				c.dump.write(entry)
+				return nil, err
+			}
+		}
+		if len(body) > 0 {
+			fmt.Fprintf(entry, "<\n%s", body)
+			if !bytes.HasSuffix(body, []byte("\n")) {
+				entry.WriteString("\n")
+			}
+			if !whole {
+				fmt.Fprintf(entry, "# body truncated to %d bytes\n", c.dump.limit)
+			}
+		}
+		entry.WriteString("\n")
+		c.dump.write(entry)
+		return res, nil
+	})
+}
+
+// peek reads up to limit bytes of body and returns them with body,
+// that is read from the beginning, whole is true if body is not longer
+func peek(body io.ReadCloser, limit int64) (data []byte, whole bool, rest io.ReadCloser, err error) {
+	if limit <= 0 {
+		return nil, false, body, nil
+	}
+	// one more byte is read to check that body is whole
+	buffer := new(bytes.Buffer)
+	if _, err = io.CopyN(buffer, body, limit+1); err != nil && err != io.EOF {
+		body.Close()
+		return nil, false, nil, err
+	}
+	read := buffer.Bytes()
+	data, whole = read, int64(len(read)) <= limit
+	if !whole {
+		data = read[:limit]
+	}
+	return data, whole, struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(read), body), body}, nil
+}
+
+// writeCurl writes curl command, that performs request with peeked body,
+// body is replaced with placeholder if it is not whole
+func writeCurl(w io.Writer, request *http.Request, body []byte, whole bool) {
+	fmt.Fprint(w, "curl -i")
+	switch request.Method {
+	case getMethod:
+	case headMethod:
+		fmt.Fprint(w, " --head")
+	default:
+		fmt.Fprintf(w, " -X %s", request.Method)
+	}
+	fmt.Fprintf(w, " %s", shellQuote(redactURL(request.URL)))
+	header := request.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if request.Host != "" && request.Host != request.URL.Host {
+		header.Set("Host", request.Host)
+	}
+	keys := headerKeys(header)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, " \\\n  -H %s", shellQuote(key+": "+redactHeader(key, value)))
+		}
+	}
+	if request.Body == nil || request.Body == http.NoBody {
+		fmt.Fprint(w, "\n")
+		return
+	}
+	if whole {
+		fmt.Fprintf(w, " \\\n  --data-binary %s\n", shellQuote(string(body)))
+		return
+	}
+	fmt.Fprint(w, " \\\n  --data-binary @body\n")
+	if len(body) > 0 {
+		fmt.Fprintf(w, "# body truncated to %d bytes: %s\n", len(body), shellQuote(string(body)))
+	}
+	if request.ContentLength > 0 {
+		fmt.Fprintf(w, "# body is %d bytes\n", request.ContentLength)
+	}
+}
+
+// writeHeaders writes sorted headers with prefix
+func writeHeaders(w io.Writer, prefix string, header http.Header) {
+	for _, key := range headerKeys(header) {
+		for _, value := range header[key] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, key, redactHeader(key, value))
+		}
+	}
+}
+
+func headerKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// redactHeader returns value of header or redacted if header is sensitive
+func redactHeader(key, value string) string {
+	for _, header := range sensitiveHeaders {
+		if strings.EqualFold(key, header) {
+			return redacted
+		}
+	}
+	return value
+}
+
+// shellQuote quotes s for posix shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	Convey("Dump", t, func() {
+		var received []string
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Proto = "HTTP/1.1"
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.Status = "204 No Content"
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "secret-token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				resp.Body = http.NoBody
+				return resp, nil
+			}
+			if request.Method == deleteMethod {
+				return nil, errors.New("connection reset")
+			}
+			if request.Body != nil {
+				data, _ := ioutil.ReadAll(request.Body)
+				received = append(received, string(data))
+			}
+			resp.Status = "200 OK"
+			resp.StatusCode = http.StatusOK
+			if request.Method == putMethod {
+				resp.Status = "201 Created"
+				resp.StatusCode = http.StatusCreated
+			}
+			resp.Header.Add("Etag", "etag")
+			resp.ContentLength = 11
+			resp.Body = ioutil.NopCloser(strings.NewReader("hello world"))
+			return resp, nil
+		}
+		buffer := new(bytes.Buffer)
+		Convey("Headers", func() {
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithDump(buffer, 0), WithUserAgent("test"))
+			So(c.Auth("user", "secret-key"), ShouldBeNil)
+			out := buffer.String()
+			So(out, ShouldNotContainSubstring, "secret")
+			So(out, ShouldContainSubstring, "# ")
+			So(out, ShouldContainSubstring, " auth attempt 1\n")
+			So(out, ShouldContainSubstring, "curl -i 'https://auth.selcdn.ru/' \\\n  -H 'User-Agent: test' \\\n  -H 'X-Auth-Key: REDACTED' \\\n  -H 'X-Auth-User: user'\n")
+			So(out, ShouldContainSubstring, "< HTTP/1.1 204 No Content\n< X-Auth-Token: REDACTED\n< X-Expire-Auth-Token: 110\n")
+			buffer.Reset()
+
+			request, err := c.NewRequest(putMethod, strings.NewReader("it's data"), "c", "o")
+			So(err, ShouldBeNil)
+			request.Header.Set("X-Auth-Token", "secret-token")
+			res, err := c.Do(request)
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(res.Body)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "hello world")
+			So(received, ShouldResemble, []string{"it's data"})
+			out = buffer.String()
+			So(out, ShouldNotContainSubstring, "secret")
+			So(out, ShouldContainSubstring, "curl -i -X PUT 'https://xxx.selcdn.ru/c/o' \\\n")
+			So(out, ShouldContainSubstring, "  --data-binary @body\n# body is 9 bytes\n")
+			So(out, ShouldContainSubstring, "< Etag: etag\n")
+			So(out, ShouldNotContainSubstring, "hello world")
+		})
+		Convey("Bodies", func() {
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithDump(buffer, 9))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.Upload(strings.NewReader("it's data"), "c", "o", ""), ShouldBeNil)
+			So(received, ShouldResemble, []string{"it's data"})
+			out := buffer.String()
+			So(out, ShouldContainSubstring, " upload attempt 1\n")
+			So(out, ShouldContainSubstring, `  --data-binary 'it'\''s data'`+"\n")
+			So(out, ShouldContainSubstring, "<\nhello wor\n# body truncated to 9 bytes\n")
+			buffer.Reset()
+
+			request, err := c.NewRequest(postMethod, strings.NewReader("long data"+" of object"), "c", "o")
+			So(err, ShouldBeNil)
+			res, err := c.Do(request)
+			So(err, ShouldBeNil)
+			res.Body.Close()
+			So(received[1], ShouldEqual, "long data of object")
+			out = buffer.String()
+			So(out, ShouldContainSubstring, "  --data-binary @body\n# body truncated to 9 bytes: 'long data'\n# body is 19 bytes\n")
+		})
+		Convey("Error", func() {
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithDump(buffer, 0))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.RemoveObject("c", "o"), ShouldNotBeNil)
+			So(buffer.String(), ShouldContainSubstring, "curl -i -X DELETE 'https://xxx.selcdn.ru/c/o' \\\n  -H 'X-Auth-Token: REDACTED'\n# error: connection reset\n")
+		})
+	})
+	Convey("Shell quote", t, func() {
+		So(shellQuote("a b"), ShouldEqual, "'a b'")
+		So(shellQuote("it's"), ShouldEqual, `'it'\''s'`)
+	})
+}
@@ -0,0 +1,258 @@
+// Package encrypted is client-side encryption of objects, that decorates
+// storage.ContainerAPI, so objects are encrypted by keys, that are never
+// sent to storage.
+//
+//	container, err := encrypted.New(api.Container("private"), masterKey)
+//	err = container.Upload(file, "report.pdf", "application/pdf")
+//	reader, err := container.Object("report.pdf").GetReader()
+//
+// Every object is encrypted by random data key with AES-256-GCM in chunks
+// of 64 KiB, so objects are streamed and ranges are read without
+// download of whole object. Data key is wrapped by master key with AES-GCM
+// and is stored with algorithm in metadata of object. Objects without
+// metadata are read as is. Sizes of ObjectInfo are sizes of plaintext,
+// except listings, that have no metadata.
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Algorithm is encryption algorithm of objects
+	Algorithm = "AES-256-GCM-64K"
+	// AlgorithmKey is metadata key of algorithm
+	AlgorithmKey = "Encryption-Algorithm"
+	// DataKeyKey is metadata key of data key, that is wrapped by master key
+	DataKeyKey = "Encryption-Key"
+
+	dataKeySize = 32
+)
+
+var (
+	// ErrorBadKey is returned for master key of invalid size
+	ErrorBadKey = errors.New("Master key must be 16, 24 or 32 bytes")
+	// ErrorBadAlgorithm is returned for objects with unknown algorithm
+	ErrorBadAlgorithm = errors.New("Unsupported encryption algorithm")
+	// ErrorCorrupted is returned if data key or data can not be decrypted
+	ErrorCorrupted = errors.New("Encrypted data is corrupted or master key is wrong")
+)
+
+// Container encrypts uploaded objects and decrypts downloaded ones
+type Container struct {
+	storage.ContainerAPI
+	master cipher.AEAD
+}
+
+var (
+	_ storage.ContainerAPI = (*Container)(nil)
+	_ storage.ObjectAPI    = (*Object)(nil)
+)
+
+// New returns encrypting container with AES master key of 16, 24 or 32 bytes
+func New(container storage.ContainerAPI, masterKey []byte) (*Container, error) {
+	switch len(masterKey) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrorBadKey
+	}
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Container{ContainerAPI: container, master: master}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrap returns data key encrypted by master key with random nonce
+func (c *Container) wrap(key []byte) (string, error) {
+	nonce := make([]byte, c.master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.master.Seal(nonce, nonce, key, nil)), nil
+}
+
+// unwrap returns cipher of data key, that is wrapped by master key
+func (c *Container) unwrap(wrapped string) (cipher.AEAD, error) {
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil || len(data) < c.master.NonceSize() {
+		return nil, ErrorCorrupted
+	}
+	size := c.master.NonceSize()
+	key, err := c.master.Open(nil, data[:size], data[size:], nil)
+	if err != nil || len(key) != dataKeySize {
+		return nil, ErrorCorrupted
+	}
+	return newAEAD(key)
+}
+
+// Upload encrypts data from reader by new data key and uploads it, blank
+// content type is detected from plain data
+func (c *Container) Upload(reader io.Reader, name, contentType string, opts ...storage.TransferOption) error {
+	if closer, ok := reader.(io.ReadCloser); ok {
+		defer closer.Close()
+	}
+	if contentType == "" {
+		// type is detected before encryption, that hides data
+		var err error
+		if contentType, reader, err = storage.DetectContentType(name, reader, opts...); err != nil {
+			return err
+		}
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	wrapped, err := c.wrap(key)
+	if err != nil {
+		return err
+	}
+	opts = append(opts[:len(opts):len(opts)],
+		storage.Metadata(AlgorithmKey, Algorithm),
+		storage.Metadata(DataKeyKey, wrapped),
+	)
+	return c.ContainerAPI.Upload(newEncrypter(aead, reader), name, contentType, opts...)
+}
+
+// UploadFile encrypts file and uploads it with its base name
+func (c *Container) UploadFile(filename string, opts ...storage.TransferOption) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(filename)
+	return c.Upload(f, name, "", opts...)
+}
+
+// ObjectInfo returns info of object with size of plaintext
+func (c *Container) ObjectInfo(name string) (storage.ObjectInfo, error) {
+	info, err := c.ContainerAPI.ObjectInfo(name)
+	if err == nil && info.Metadata[AlgorithmKey] == Algorithm {
+		info.Size = uint64(plainSize(int64(info.Size)))
+	}
+	return info, err
+}
+
+// Object returns encrypted object
+func (c *Container) Object(name string) storage.ObjectAPI {
+	return &Object{container: c, name: name}
+}
+
+// Objects returns all encrypted objects of container
+func (c *Container) Objects() ([]storage.ObjectAPI, error) {
+	info, err := c.ContainerAPI.ObjectsInfo()
+	if err != nil {
+		return nil, err
+	}
+	var objects []storage.ObjectAPI
+	for _, object := range info {
+		if object.Subdir == "" {
+			objects = append(objects, c.Object(object.Name))
+		}
+	}
+	return objects, nil
+}
+
+// Object is object of encrypting container
+type Object struct {
+	container *Container
+	name      string
+}
+
+// Info returns info of object with size of plaintext
+func (o *Object) Info() (storage.ObjectInfo, error) {
+	return o.container.ObjectInfo(o.name)
+}
+
+// Remove removes object
+func (o *Object) Remove() error {
+	return o.container.RemoveObject(o.name)
+}
+
+// Download returns decrypted data of object
+func (o *Object) Download() ([]byte, error) {
+	reader, err := o.GetReader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Upload encrypts data from reader and uploads it to object
+func (o *Object) Upload(reader io.Reader, contentType string, opts ...storage.TransferOption) error {
+	return o.container.Upload(reader, o.name, contentType, opts...)
+}
+
+// UploadFile encrypts file and uploads it with its base name
+func (o *Object) UploadFile(filename string, opts ...storage.TransferOption) error {
+	return o.container.UploadFile(filename, opts...)
+}
+
+// GetReader returns reader of decrypted data or its range, only chunks of
+// range are downloaded
+func (o *Object) GetReader(opts ...storage.TransferOption) (io.ReadCloser, error) {
+	object := o.container.ContainerAPI.Object(o.name)
+	info, err := o.container.ContainerAPI.ObjectInfo(o.name)
+	if err != nil {
+		return nil, err
+	}
+	switch info.Metadata[AlgorithmKey] {
+	case "":
+		return object.GetReader(opts...)
+	case Algorithm:
+	default:
+		return nil, ErrorBadAlgorithm
+	}
+	aead, err := o.container.unwrap(info.Metadata[DataKeyKey])
+	if err != nil {
+		return nil, err
+	}
+	size := int64(info.Size)
+	plain := plainSize(size)
+	offset, length := storage.RequestedRange(opts...)
+	if offset >= plain && offset > 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	end := plain
+	if length > 0 && offset+length < plain {
+		end = offset + length
+	}
+	first, last := offset/chunkSize, (end-1)/chunkSize
+	if last < first {
+		last = first
+	}
+	sealedOffset := first * sealedSize
+	sealedLength := (last - first + 1) * sealedSize
+	if sealedOffset+sealedLength > size {
+		sealedLength = size - sealedOffset
+	}
+	opts = append(opts[:len(opts):len(opts)], storage.Range(sealedOffset, sealedLength))
+	reader, err := object.GetReader(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newDecrypter(aead, reader, first, chunks(size)-1, offset-first*chunkSize, end-offset), nil
+}
@@ -0,0 +1,163 @@
+package encrypted
+
+import (
+	"bytes"
+	"crypto/rand"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/storagetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainer(t *testing.T) {
+	Convey("Container", t, func() {
+		m := storagetest.NewMemory()
+		plain, err := m.CreateContainer("c", false)
+		So(err, ShouldBeNil)
+		master := bytes.Repeat([]byte{1}, 32)
+		container, err := New(plain, master)
+		So(err, ShouldBeNil)
+		random := func(size int) []byte {
+			data := make([]byte, size)
+			rand.Read(data)
+			return data
+		}
+		read := func(object storage.ObjectAPI, opts ...storage.TransferOption) ([]byte, error) {
+			reader, err := object.GetReader(opts...)
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return ioutil.ReadAll(reader)
+		}
+
+		Convey("Round trip", func() {
+			for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+				data := random(size)
+				So(container.Upload(bytes.NewReader(data), "object", "application/octet-stream"), ShouldBeNil)
+				downloaded, err := container.Object("object").Download()
+				So(err, ShouldBeNil)
+				So(bytes.Equal(downloaded, data), ShouldBeTrue)
+				info, err := container.ObjectInfo("object")
+				So(err, ShouldBeNil)
+				So(info.Size, ShouldEqual, size)
+				stored, err := plain.ObjectInfo("object")
+				So(err, ShouldBeNil)
+				So(stored.Size, ShouldBeGreaterThan, size)
+				So(stored.Metadata[AlgorithmKey], ShouldEqual, Algorithm)
+				So(stored.Metadata[DataKeyKey], ShouldNotBeEmpty)
+			}
+		})
+		Convey("Range", func() {
+			data := random(3*chunkSize + 5)
+			So(container.Object("object").Upload(bytes.NewReader(data), "application/octet-stream"), ShouldBeNil)
+			for _, r := range [][2]int64{
+				{10, 20},
+				{chunkSize - 5, 10},
+				{chunkSize, chunkSize},
+				{2*chunkSize + 1, 0},
+				{3 * chunkSize, 100},
+				{0, 3*chunkSize + 5},
+			} {
+				part, err := read(container.Object("object"), storage.Range(r[0], r[1]))
+				So(err, ShouldBeNil)
+				end := int64(len(data))
+				if r[1] > 0 && r[0]+r[1] < end {
+					end = r[0] + r[1]
+				}
+				So(bytes.Equal(part, data[r[0]:end]), ShouldBeTrue)
+			}
+			part, err := read(container.Object("object"), storage.Range(int64(len(data))+1, 0))
+			So(err, ShouldBeNil)
+			So(part, ShouldBeEmpty)
+		})
+		Convey("Compressed", func() {
+			data := bytes.Repeat([]byte("data"), chunkSize)
+			So(container.Upload(bytes.NewReader(data), "object", "text/plain", storage.Compress(storage.EncodingGzip)), ShouldBeNil)
+			info, err := container.ObjectInfo("object")
+			So(err, ShouldBeNil)
+			So(info.Size, ShouldEqual, len(data))
+			part, err := read(container.Object("object"), storage.Range(chunkSize+1, 10))
+			So(err, ShouldBeNil)
+			So(bytes.Equal(part, data[chunkSize+1:chunkSize+11]), ShouldBeTrue)
+		})
+		Convey("Stored data", func() {
+			data := []byte("secret data")
+			So(container.Upload(bytes.NewReader(data), "object", "text/plain"), ShouldBeNil)
+			stored, err := plain.Object("object").Download()
+			So(err, ShouldBeNil)
+			So(bytes.Contains(stored, data), ShouldBeFalse)
+			So(len(stored), ShouldEqual, len(data)+chunkOverhead)
+			info, err := plain.ObjectInfo("object")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldEqual, "text/plain")
+
+			Convey("Tampered", func() {
+				stored[0] ^= 1
+				So(plain.Upload(bytes.NewReader(stored), "object", "text/plain", storage.Metadata(AlgorithmKey, Algorithm),
+					storage.Metadata(DataKeyKey, info.Metadata[DataKeyKey])), ShouldBeNil)
+				_, err := container.Object("object").Download()
+				So(err, ShouldEqual, ErrorCorrupted)
+			})
+			Convey("Wrong key", func() {
+				other, err := New(plain, bytes.Repeat([]byte{2}, 16))
+				So(err, ShouldBeNil)
+				_, err = other.Object("object").Download()
+				So(err, ShouldEqual, ErrorCorrupted)
+			})
+			Convey("Bad algorithm", func() {
+				So(plain.Upload(bytes.NewReader(stored), "object", "text/plain", storage.Metadata(AlgorithmKey, "ROT13")), ShouldBeNil)
+				_, err := container.Object("object").Download()
+				So(err, ShouldEqual, ErrorBadAlgorithm)
+			})
+		})
+		Convey("Truncated", func() {
+			data := random(2*chunkSize + 1)
+			So(container.Upload(bytes.NewReader(data), "object", "application/octet-stream"), ShouldBeNil)
+			stored, err := plain.Object("object").Download()
+			So(err, ShouldBeNil)
+			info, err := plain.ObjectInfo("object")
+			So(err, ShouldBeNil)
+			So(plain.Upload(bytes.NewReader(stored[:2*sealedSize]), "object", "application/octet-stream",
+				storage.Metadata(AlgorithmKey, Algorithm), storage.Metadata(DataKeyKey, info.Metadata[DataKeyKey])), ShouldBeNil)
+			_, err = container.Object("object").Download()
+			So(err, ShouldEqual, ErrorCorrupted)
+		})
+		Convey("Not encrypted", func() {
+			So(plain.Upload(bytes.NewBufferString("plain"), "plain", "text/plain"), ShouldBeNil)
+			data, err := container.Object("plain").Download()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "plain")
+			info, err := container.Object("plain").Info()
+			So(err, ShouldBeNil)
+			So(info.Size, ShouldEqual, 5)
+		})
+		Convey("UploadFile", func() {
+			dir, err := ioutil.TempDir("", "encrypted")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			filename := filepath.Join(dir, "notes.txt")
+			So(ioutil.WriteFile(filename, []byte("notes"), 0644), ShouldBeNil)
+			So(container.UploadFile(filename), ShouldBeNil)
+			objects, err := container.Objects()
+			So(err, ShouldBeNil)
+			So(objects, ShouldHaveLength, 1)
+			data, err := objects[0].Download()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "notes")
+			info, err := plain.ObjectInfo("notes.txt")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldStartWith, "text/plain")
+			So(objects[0].Remove(), ShouldBeNil)
+			_, err = plain.ObjectInfo("notes.txt")
+			So(err, ShouldEqual, storage.ErrorObjectNotFound)
+		})
+		Convey("Bad key", func() {
+			_, err := New(plain, []byte("short"))
+			So(err, ShouldEqual, ErrorBadKey)
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package encrypted
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	// chunkSize is size of plaintext of chunk, last chunk can be shorter
+	chunkSize = 64 << 10
+	// chunkOverhead is size of authentication tag of chunk
+	chunkOverhead = 16
+	// sealedSize is size of encrypted chunk
+	sealedSize = chunkSize + chunkOverhead
+)
+
+// nonce returns nonce of chunk with index, last chunk has flag set, so
+// truncated stream can not be decrypted. Data key is unique for object,
+// so counter nonces are not reused
+func nonce(aead cipher.AEAD, index int64, last bool) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(n, uint64(index))
+	if last {
+		n[len(n)-1] = 1
+	}
+	return n
+}
+
+// chunks returns count of chunks of encrypted data with size, stream
+// has at least one chunk
+func chunks(size int64) int64 {
+	if size <= sealedSize {
+		return 1
+	}
+	return (size + sealedSize - 1) / sealedSize
+}
+
+// plainSize returns size of plaintext of encrypted data with size
+func plainSize(size int64) int64 {
+	if size < chunkOverhead {
+		return 0
+	}
+	return size - chunks(size)*chunkOverhead
+}
+
+// encrypter is reader of encrypted chunks of plaintext reader
+type encrypter struct {
+	aead   cipher.AEAD
+	source *bufio.Reader
+	plain  []byte
+	buf    []byte
+	sealed []byte
+	index  int64
+	done   bool
+	err    error
+}
+
+func newEncrypter(aead cipher.AEAD, r io.Reader) *encrypter {
+	return &encrypter{
+		aead:   aead,
+		source: bufio.NewReaderSize(r, chunkSize),
+		plain:  make([]byte, chunkSize),
+		buf:    make([]byte, 0, sealedSize),
+	}
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.sealed) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		if e.done {
+			return 0, io.EOF
+		}
+		e.seal()
+	}
+	n := copy(p, e.sealed)
+	e.sealed = e.sealed[n:]
+	return n, nil
+}
+
+// seal encrypts next chunk, chunk is last if nothing can be read after it
+func (e *encrypter) seal() {
+	n, err := io.ReadFull(e.source, e.plain)
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		e.done = true
+	} else if err == nil {
+		if _, err = e.source.Peek(1); err == io.EOF {
+			e.done = true
+		} else if err != nil {
+			e.err = err
+			return
+		}
+	} else {
+		e.err = err
+		return
+	}
+	e.sealed = e.aead.Seal(e.buf[:0], nonce(e.aead, e.index, e.done), e.plain[:n], nil)
+	e.index++
+}
+
+// decrypter is reader of plaintext of encrypted chunks, that start with
+// chunk index, final is index of last chunk of object. First skip bytes
+// of plaintext are dropped and only limit bytes are read
+type decrypter struct {
+	aead   cipher.AEAD
+	source io.ReadCloser
+	sealed []byte
+	buf    []byte
+	plain  []byte
+	index  int64
+	final  int64
+	skip   int64
+	limit  int64
+	err    error
+}
+
+func newDecrypter(aead cipher.AEAD, r io.ReadCloser, index, final, skip, limit int64) *decrypter {
+	return &decrypter{
+		aead:   aead,
+		source: r,
+		sealed: make([]byte, sealedSize),
+		buf:    make([]byte, 0, chunkSize),
+		index:  index,
+		final:  final,
+		skip:   skip,
+		limit:  limit,
+	}
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.limit <= 0 || d.index > d.final {
+			return 0, io.EOF
+		}
+		d.open()
+		if int64(len(d.plain)) <= d.skip {
+			d.skip -= int64(len(d.plain))
+			d.plain = d.plain[:0]
+			continue
+		}
+		d.plain = d.plain[d.skip:]
+		d.skip = 0
+	}
+	if int64(len(d.plain)) > d.limit {
+		d.plain = d.plain[:d.limit]
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	d.limit -= int64(n)
+	return n, nil
+}
+
+// open decrypts next chunk, only final chunk can be shorter
+func (d *decrypter) open() {
+	n, err := io.ReadFull(d.source, d.sealed)
+	last := d.index == d.final
+	if err == io.ErrUnexpectedEOF && last {
+		err = nil
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		d.err = err
+		return
+	}
+	d.plain, err = d.aead.Open(d.buf[:0], nonce(d.aead, d.index, last), d.sealed[:n], nil)
+	if err != nil {
+		d.err = ErrorCorrupted
+		return
+	}
+	d.index++
+}
+
+func (d *decrypter) Close() error {
+	return d.source.Close()
+}
@@ -38,7 +38,7 @@ func TestIntegration(t *testing.T) {
 		Convey("Async", func() {
 			user := os.Getenv(EnvUser)
 			key := os.Getenv(EnvKey)
-			c := NewAsync(user, key)
+			c := NewAsync(user, key, envOptions()...)
 			info := c.Info()
 			So(info.BytesUsed, ShouldNotEqual, 0)
 			So(info.ObjectCount, ShouldNotEqual, 0)
@@ -53,7 +53,7 @@ func TestIntegration(t *testing.T) {
 				NewAsync(user, "")
 			}, ShouldPanic)
 			Convey("Error", func() {
-				c := NewAsync(randString(10), randString(10))
+				c := NewAsync(randString(10), randString(10), envOptions()...)
 				uploadData := randData(512)
 				f, err := ioutil.TempFile("", randString(12))
 				defer f.Close()
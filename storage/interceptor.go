@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+)
+
+// Interceptor wraps client to add behaviour to requests, e.g. headers,
+// tracing or rewriting. Interceptor can modify request before calling
+// next client and response after it.
+type Interceptor func(next DoClient) DoClient
+
+// Chain returns client, that passes requests through interceptors
+// to client, first interceptor is outermost
+func Chain(client DoClient, interceptors ...Interceptor) DoClient {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		client = interceptors[i](client)
+	}
+	return client
+}
+
+// WithInterceptors adds interceptors, that are called for every request,
+// including authentication, after token is added and before request is
+// logged and sent by http client
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// attemptKey is context key of request attempt number
+type attemptKey struct{}
+
+// attempt returns number of request attempt, starting from 1
+func attempt(request *http.Request) int {
+	if n, ok := request.Context().Value(attemptKey{}).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// buildChain creates chains for authentication and for api requests,
+// built-in interceptors are:
+//
+//	replay -> auth -> trace -> custom interceptors -> user agent -> dump -> log -> http client
+//
+// Authentication requests are marked with OperationAuth.
+func (c *Client) buildChain() {
+	transport := DoFunc(func(request *http.Request) (*http.Response, error) {
+		return c.client.Do(request)
+	})
+	interceptors := append([]Interceptor{c.traceInterceptor}, c.interceptors...)
+	interceptors = append(interceptors, c.userAgentInterceptor, c.dumpInterceptor, c.logInterceptor)
+	send := Chain(transport, interceptors...)
+	c.authChain = Chain(send, operationInterceptor(OperationAuth))
+	c.chain = Chain(send, c.replayInterceptor, c.authInterceptor)
+}
+
+// replayInterceptor replays request once with new token if token is
+// rejected, ErrorBodyNotRewindable is returned if body can not be rewound
+func (c *Client) replayInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		res, err := next.Do(request)
+		if err != nil || res.StatusCode != http.StatusUnauthorized {
+			return res, err
+		}
+		res.Body.Close()
+		if err = rewind(request); err != nil {
+			return nil, err
+		}
+		c.log(request.Context(), LevelInfo, "token rejected, performing auth")
+		retry := request.WithContext(context.WithValue(request.Context(), attemptKey{}, attempt(request)+1))
+		if res, err = next.Do(retry); err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized {
+			res.Body.Close()
+			return nil, ErrorAuth
+		}
+		return res, nil
+	})
+}
+
+// authInterceptor performs auth if token is expired and adds token to
+// request, token is invalidated if server rejects it
+func (c *Client) authInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		token, err := c.authorize(request)
+		if err != nil {
+			return nil, err
+		}
+		if !blank(token) {
+			request.Header.Set(authTokenHeader, token)
+		}
+		res, err := next.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized {
+			// ensure that next request will force authentication
+			// and will not load rejected token from store
+			c.mu.Lock()
+			if c.token == token {
+				c.expireFrom = nil
+				c.rejected = token
+			}
+			c.mu.Unlock()
+		}
+		return res, nil
+	})
+}
+
+// userAgentInterceptor sets User-Agent header from options
+func (c *Client) userAgentInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		if !blank(c.userAgent) {
+			if request.Header == nil {
+				request.Header = http.Header{}
+			}
+			request.Header.Set(userAgentHeader, c.userAgent)
+		}
+		return next.Do(request)
+	})
+}
+
+// logInterceptor logs requests in debug mode
+func (c *Client) logInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		if !c.debug() {
+			return next.Do(request)
+		}
+		// perform request and record time elapsed
+		start := c.clock.Now()
+		res, err := next.Do(request)
+		c.logRequest(request, res, err, c.clock.Now().Sub(start), attempt(request))
+		return res, err
+	})
+}
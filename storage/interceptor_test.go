@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+// headerInterceptor sets header and records order of calls
+func headerInterceptor(name string, calls *[]string) Interceptor {
+	return func(next DoClient) DoClient {
+		return DoFunc(func(request *http.Request) (*http.Response, error) {
+			*calls = append(*calls, name)
+			request.Header.Add("X-Interceptor", name)
+			return next.Do(request)
+		})
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	Convey("Interceptors", t, func() {
+		var (
+			calls    []string
+			requests []*http.Request
+			reject   bool
+		)
+		callback := func(request *http.Request) (*http.Response, error) {
+			requests = append(requests, request)
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			resp.StatusCode = http.StatusNoContent
+			if reject {
+				reject = false
+				resp.StatusCode = http.StatusUnauthorized
+			}
+			return resp, nil
+		}
+		Convey("Chain", func() {
+			client := Chain(NewTestClient(callback), headerInterceptor("a", &calls), headerInterceptor("b", &calls))
+			request, err := http.NewRequest(getMethod, "https://xxx.selcdn.ru/", nil)
+			So(err, ShouldBeNil)
+			_, err = client.Do(request)
+			So(err, ShouldBeNil)
+			So(calls, ShouldResemble, []string{"a", "b"})
+			So(requests[0].Header["X-Interceptor"], ShouldResemble, []string{"a", "b"})
+			So(Chain(nil), ShouldBeNil)
+		})
+		Convey("Client", func() {
+			c := newClient(
+				WithHTTPClient(NewTestClient(callback)),
+				WithUserAgent("test"),
+				WithInterceptors(headerInterceptor("a", &calls)),
+				WithInterceptors(headerInterceptor("b", &calls)),
+			)
+			c.user, c.key = "user", "key"
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(calls, ShouldResemble, []string{"a", "b", "a", "b"})
+			So(requests, ShouldHaveLength, 2)
+			auth, api := requests[0], requests[1]
+			So(auth.Header["X-Interceptor"], ShouldResemble, []string{"a", "b"})
+			So(auth.Header.Get("User-Agent"), ShouldEqual, "test")
+			So(auth.Header.Get("X-Auth-Token"), ShouldEqual, "")
+			So(api.Header["X-Interceptor"], ShouldResemble, []string{"a", "b"})
+			So(api.Header.Get("User-Agent"), ShouldEqual, "test")
+			So(api.Header.Get("X-Auth-Token"), ShouldEqual, "token")
+			Convey("Replay", func() {
+				calls = nil
+				reject = true
+				So(c.RemoveObject("c", "o"), ShouldBeNil)
+				// rejected request, auth and replayed request
+				So(calls, ShouldHaveLength, 6)
+			})
+		})
+		Convey("Short circuit", func() {
+			errBlocked := errors.New("blocked")
+			block := func(next DoClient) DoClient {
+				return DoFunc(func(request *http.Request) (*http.Response, error) {
+					if request.Method == deleteMethod {
+						return nil, errBlocked
+					}
+					return next.Do(request)
+				})
+			}
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithInterceptors(block))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.RemoveObject("c", "o"), ShouldEqual, errBlocked)
+			So(requests, ShouldHaveLength, 1)
+		})
+		Convey("Attempt", func() {
+			logger := new(testLogger)
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithLogger(logger))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			c.Debug(true)
+			reject = true
+			request, err := c.NewRequest(putMethod, bytes.NewReader([]byte("data")), "c", "o")
+			So(err, ShouldBeNil)
+			res, err := c.Do(request)
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, http.StatusNoContent)
+			body, err := ioutil.ReadAll(requests[len(requests)-1].Body)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, "data")
+			var attempts []interface{}
+			for _, r := range logger.records {
+				if r.msg == "request" {
+					attempts = append(attempts, r.fields["attempt"])
+				}
+			}
+			// rejected request, auth and replayed request
+			So(attempts, ShouldResemble, []interface{}{1, 1, 2})
+		})
+	})
+}
@@ -0,0 +1,52 @@
+// Package batch walks local directories and runs tasks by workers, that is
+// shared by storage.UploadDir and dirsync
+package batch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// Files calls f for every regular file of dir with path relative to dir
+// and separated by slash, dir itself is skipped if it is not directory
+func Files(dir string, f func(name, path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() || p == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return f(filepath.ToSlash(rel), p, info)
+	})
+}
+
+// Run calls f for indexes from 0 to n-1 by count of workers, at least one,
+// and waits for all calls
+func Run(workers, n int, f func(i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+	indexes := make(chan int)
+	wg := new(sync.WaitGroup)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				f(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
@@ -0,0 +1,55 @@
+package batch
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	Convey("Files", t, func() {
+		dir, err := ioutil.TempDir("", "batch")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		So(os.MkdirAll(filepath.Join(dir, "a", "b"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "a", "b", "c.txt"), []byte("data"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "root"), []byte("root"), 0644), ShouldBeNil)
+		var names []string
+		So(Files(dir, func(name, path string, info fs.FileInfo) error {
+			So(path, ShouldEqual, filepath.Join(dir, filepath.FromSlash(name)))
+			names = append(names, name)
+			return nil
+		}), ShouldBeNil)
+		So(names, ShouldResemble, []string{"a/b/c.txt", "root"})
+		Convey("Regular file", func() {
+			names = nil
+			So(Files(filepath.Join(dir, "root"), func(name, path string, info fs.FileInfo) error {
+				names = append(names, name)
+				return nil
+			}), ShouldBeNil)
+			So(names, ShouldBeEmpty)
+		})
+		Convey("Missing", func() {
+			err := Files(filepath.Join(dir, "missing"), nil)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+	Convey("Run", t, func() {
+		var (
+			mu      sync.Mutex
+			indexes []int
+		)
+		Run(0, 5, func(i int) {
+			mu.Lock()
+			indexes = append(indexes, i)
+			mu.Unlock()
+		})
+		sort.Ints(indexes)
+		So(indexes, ShouldResemble, []int{0, 1, 2, 3, 4})
+	})
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	keystoneTokensPath       = "auth/tokens"
+	keystoneSubjectHeader    = "X-Subject-Token"
+	keystonePasswordMethod   = "password"
+	keystoneObjectStoreType  = "object-store"
+	keystoneDefaultInterface = "public"
+	jsonContentType          = "application/json"
+)
+
+var (
+	// ErrorEndpointNotFound occurs when keystone catalog has no object storage endpoint
+	ErrorEndpointNotFound = errors.New("Object storage endpoint not found in catalog")
+)
+
+// KeystoneAuth is OpenStack Keystone v3 password authentication with
+// project-scoped token, that uses object-store endpoint from service catalog
+type KeystoneAuth struct {
+	// URL of identity api, e.g. https://cloud.api.selcloud.ru/identity/v3
+	URL string
+	// Domain is name of user domain, for selectel it is account id
+	Domain string
+	// Project is project name, that is used for token scope
+	Project string
+	// ProjectID is used for token scope instead of Project if set
+	ProjectID string
+	// ProjectDomain is domain name of project, Domain is used if blank
+	ProjectDomain string
+	// Region of endpoint, any region is used if blank
+	Region string
+	// Interface of endpoint, public by default
+	Interface string
+	// Clock is used to calculate token lifetime, SystemClock if nil
+	Clock Clock
+}
+
+type keystoneName struct {
+	Name string `json:"name"`
+}
+
+type keystoneUser struct {
+	Name     string        `json:"name"`
+	Domain   *keystoneName `json:"domain,omitempty"`
+	Password string        `json:"password"`
+}
+
+type keystoneProject struct {
+	ID     string        `json:"id,omitempty"`
+	Name   string        `json:"name,omitempty"`
+	Domain *keystoneName `json:"domain,omitempty"`
+}
+
+type keystoneScope struct {
+	Project keystoneProject `json:"project"`
+}
+
+type keystoneRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User keystoneUser `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope *keystoneScope `json:"scope,omitempty"`
+	} `json:"auth"`
+}
+
+type keystoneEndpoint struct {
+	Interface string `json:"interface"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	URL       string `json:"url"`
+}
+
+type keystoneResponse struct {
+	Token struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		Catalog   []struct {
+			Type      string             `json:"type"`
+			Endpoints []keystoneEndpoint `json:"endpoints"`
+		} `json:"catalog"`
+	} `json:"token"`
+}
+
+func (a *KeystoneAuth) request(user, key string) keystoneRequest {
+	var body keystoneRequest
+	identity := &body.Auth.Identity
+	identity.Methods = []string{keystonePasswordMethod}
+	identity.Password.User = keystoneUser{Name: user, Password: key}
+	if !blank(a.Domain) {
+		identity.Password.User.Domain = &keystoneName{Name: a.Domain}
+	}
+	if blank(a.Project) && blank(a.ProjectID) {
+		return body
+	}
+	body.Auth.Scope = new(keystoneScope)
+	project := &body.Auth.Scope.Project
+	if !blank(a.ProjectID) {
+		project.ID = a.ProjectID
+		return body
+	}
+	project.Name = a.Project
+	domain := a.ProjectDomain
+	if blank(domain) {
+		domain = a.Domain
+	}
+	if !blank(domain) {
+		project.Domain = &keystoneName{Name: domain}
+	}
+	return body
+}
+
+// endpoint returns url of object storage endpoint from catalog
+func (a *KeystoneAuth) endpoint(res keystoneResponse) (string, error) {
+	iface := a.Interface
+	if blank(iface) {
+		iface = keystoneDefaultInterface
+	}
+	for _, service := range res.Token.Catalog {
+		if service.Type != keystoneObjectStoreType {
+			continue
+		}
+		for _, e := range service.Endpoints {
+			if e.Interface != iface {
+				continue
+			}
+			if !blank(a.Region) && e.Region != a.Region && e.RegionID != a.Region {
+				continue
+			}
+			return e.URL, nil
+		}
+	}
+	return "", ErrorEndpointNotFound
+}
+
+// Authenticate requests project-scoped token from keystone
+func (a *KeystoneAuth) Authenticate(client DoClient, user, key string) (*AuthToken, error) {
+	body, err := json.Marshal(a.request(user, key))
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(a.URL, "/") + "/" + keystoneTokensPath
+	request, err := http.NewRequest(postMethod, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(contentTypeHeader, jsonContentType)
+
+	res, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return nil, ErrorAuth
+	}
+	var data keystoneResponse
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, ErrorBadJSON
+	}
+	storageURL, err := a.endpoint(data)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthToken{
+		Token:      res.Header.Get(keystoneSubjectHeader),
+		StorageURL: storageURL,
+		Expire:     int(data.Token.ExpiresAt.Sub(clockOrSystem(a.Clock).Now()) / time.Second),
+	}, nil
+}
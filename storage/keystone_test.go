@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const keystoneCatalog = `
+{
+	"token": {
+		"expires_at": "%s",
+		"catalog": [
+			{
+				"type": "identity",
+				"endpoints": [
+					{"interface": "public", "region": "ru-1", "region_id": "ru-1", "url": "https://cloud.api.selcloud.ru/identity"}
+				]
+			},
+			{
+				"type": "object-store",
+				"endpoints": [
+					{"interface": "admin", "region": "ru-1", "region_id": "ru-1", "url": "https://admin.storage.selcloud.ru/v1/project"},
+					{"interface": "public", "region": "ru-1", "region_id": "ru-1", "url": "https://swift.ru-1.storage.selcloud.ru/v1/project"},
+					{"interface": "public", "region": "ru-7", "region_id": "ru-7", "url": "https://swift.ru-7.storage.selcloud.ru/v1/project"}
+				]
+			}
+		]
+	}
+}`
+
+func TestKeystone(t *testing.T) {
+	Convey("Keystone", t, func() {
+		expires := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		auth := &KeystoneAuth{
+			URL:     "https://cloud.api.selcloud.ru/identity/v3/",
+			Domain:  "123456",
+			Project: "project",
+		}
+		var body keystoneRequest
+		callback := func(request *http.Request) (*http.Response, error) {
+			So(request.URL.String(), ShouldEqual, "https://cloud.api.selcloud.ru/identity/v3/auth/tokens")
+			So(request.Method, ShouldEqual, "POST")
+			So(request.Header.Get("Content-Type"), ShouldEqual, "application/json")
+			So(json.NewDecoder(request.Body).Decode(&body), ShouldBeNil)
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.Header.Add("X-Subject-Token", "token")
+			resp.StatusCode = http.StatusCreated
+			resp.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(keystoneCatalog, expires)))
+			return resp, nil
+		}
+		Convey("Ok", func() {
+			token, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldBeNil)
+			So(token.Token, ShouldEqual, "token")
+			So(token.StorageURL, ShouldEqual, "https://swift.ru-1.storage.selcloud.ru/v1/project")
+			So(token.Expire, ShouldBeGreaterThan, 3500)
+			So(token.Expire, ShouldBeLessThan, 3601)
+			So(body.Auth.Identity.Methods, ShouldResemble, []string{"password"})
+			So(body.Auth.Identity.Password.User.Name, ShouldEqual, "user")
+			So(body.Auth.Identity.Password.User.Password, ShouldEqual, "password")
+			So(body.Auth.Identity.Password.User.Domain.Name, ShouldEqual, "123456")
+			So(body.Auth.Scope.Project.Name, ShouldEqual, "project")
+			So(body.Auth.Scope.Project.Domain.Name, ShouldEqual, "123456")
+		})
+		Convey("Project id", func() {
+			auth.ProjectID = "id"
+			_, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldBeNil)
+			So(body.Auth.Scope.Project.ID, ShouldEqual, "id")
+			So(body.Auth.Scope.Project.Name, ShouldEqual, "")
+			So(body.Auth.Scope.Project.Domain, ShouldBeNil)
+		})
+		Convey("Unscoped", func() {
+			auth.Project = ""
+			_, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldBeNil)
+			So(body.Auth.Scope, ShouldBeNil)
+		})
+		Convey("Region", func() {
+			auth.Region = "ru-7"
+			token, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldBeNil)
+			So(token.StorageURL, ShouldEqual, "https://swift.ru-7.storage.selcloud.ru/v1/project")
+		})
+		Convey("Interface", func() {
+			auth.Interface = "admin"
+			token, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldBeNil)
+			So(token.StorageURL, ShouldEqual, "https://admin.storage.selcloud.ru/v1/project")
+		})
+		Convey("No endpoint", func() {
+			auth.Region = "ru-2"
+			_, err := auth.Authenticate(NewTestClient(callback), "user", "password")
+			So(err, ShouldEqual, ErrorEndpointNotFound)
+		})
+		Convey("Bad code", func() {
+			resp := new(http.Response)
+			resp.StatusCode = http.StatusUnauthorized
+			_, err := auth.Authenticate(NewTestClientSimple(resp), "user", "password")
+			So(err, ShouldEqual, ErrorAuth)
+		})
+		Convey("Bad json", func() {
+			resp := new(http.Response)
+			resp.StatusCode = http.StatusCreated
+			resp.Body = ioutil.NopCloser(bytes.NewBufferString("{"))
+			_, err := auth.Authenticate(NewTestClientSimple(resp), "user", "password")
+			So(err, ShouldEqual, ErrorBadJSON)
+		})
+		Convey("Request error", func() {
+			_, err := auth.Authenticate(NewTestClientError(nil, http.ErrHandlerTimeout), "user", "password")
+			So(err, ShouldEqual, http.ErrHandlerTimeout)
+		})
+		Convey("Client", func() {
+			c := newClient(WithAuthenticator(auth))
+			c.setClient(NewTestClient(callback))
+			So(c.Auth("user", "password"), ShouldBeNil)
+			So(c.Token(), ShouldEqual, "token")
+			So(c.URL("container", "object"), ShouldEqual, "https://swift.ru-1.storage.selcloud.ru/v1/project/container/object")
+		})
+	})
+}
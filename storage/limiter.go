@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// maxLimitedRead is maximum size of single read of limited reader,
+// so waits are short and transfer is smooth
+const maxLimitedRead = 32 * 1024
+
+// limiter is token bucket of bytes, that allows burst of one second
+type limiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+func newLimiter(rate int64, clock Clock) *limiter {
+	return &limiter{rate: rate, tokens: float64(rate), last: clock.Now(), clock: clock}
+}
+
+// wait takes n bytes from bucket and blocks until they are allowed,
+// concurrent waits are queued because bucket can go negative
+func (l *limiter) wait(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if burst := float64(l.rate); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+	if deficit <= 0 {
+		return
+	}
+	timer := l.clock.NewTimer(time.Duration(deficit / float64(l.rate) * float64(time.Second)))
+	<-timer.C()
+}
+
+// limitedReader reads from r not faster than all of limiters allow
+type limitedReader struct {
+	r        io.Reader
+	limiters []*limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	size := maxLimitedRead
+	for _, l := range r.limiters {
+		if l.rate < int64(size) {
+			size = int(l.rate)
+		}
+	}
+	if len(p) > size {
+		p = p[:size]
+	}
+	n, err := r.r.Read(p)
+	for _, l := range r.limiters {
+		l.wait(n)
+	}
+	return n, err
+}
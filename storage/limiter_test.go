@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sleepClock is testClock, that is moved by timers instead of waiting
+type sleepClock struct {
+	*testClock
+	mu     sync.Mutex
+	sleeps []time.Duration
+}
+
+func (c *sleepClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.mu.Unlock()
+	c.Add(d)
+	timer := firedTimer(make(chan time.Time, 1))
+	timer <- c.Now()
+	return timer
+}
+
+type firedTimer chan time.Time
+
+func (t firedTimer) C() <-chan time.Time {
+	return t
+}
+
+func (t firedTimer) Stop() bool {
+	return false
+}
+
+func TestLimiter(t *testing.T) {
+	Convey("Limiter", t, func() {
+		clock := &sleepClock{testClock: newTestClock()}
+		start := clock.Now()
+		Convey("Wait", func() {
+			l := newLimiter(100, clock)
+			l.wait(100)
+			So(clock.sleeps, ShouldBeEmpty)
+			l.wait(50)
+			So(clock.sleeps, ShouldResemble, []time.Duration{500 * time.Millisecond})
+			l.wait(50)
+			So(clock.Now().Sub(start), ShouldEqual, time.Second)
+			clock.Add(10 * time.Second)
+			l.wait(100)
+			So(clock.Now().Sub(start), ShouldEqual, 11*time.Second)
+		})
+		Convey("Reader", func() {
+			reader := &limitedReader{
+				r:        bytes.NewReader(make([]byte, 300)),
+				limiters: []*limiter{newLimiter(100, clock)},
+			}
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(data, ShouldHaveLength, 300)
+			So(clock.Now().Sub(start), ShouldEqual, 2*time.Second)
+		})
+		Convey("Client", func() {
+			callback := func(request *http.Request) (*http.Response, error) {
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				if request.URL.String() == "https://auth.selcdn.ru/" {
+					resp.StatusCode = http.StatusNoContent
+					resp.Header.Add("X-Expire-Auth-Token", "110")
+					resp.Header.Add("X-Auth-Token", "token")
+					resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+					return resp, nil
+				}
+				if request.Method == putMethod {
+					ioutil.ReadAll(request.Body)
+					resp.StatusCode = http.StatusCreated
+					return resp, nil
+				}
+				resp.StatusCode = http.StatusOK
+				resp.Body = ioutil.NopCloser(bytes.NewReader(make([]byte, 300)))
+				return resp, nil
+			}
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithRateLimit(100))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			download := func(opts ...TransferOption) {
+				reader, err := c.C("c").Object("o").GetReader(opts...)
+				So(err, ShouldBeNil)
+				data, err := ioutil.ReadAll(reader)
+				So(err, ShouldBeNil)
+				So(data, ShouldHaveLength, 300)
+				So(reader.Close(), ShouldBeNil)
+			}
+			Convey("Global", func() {
+				download()
+				So(clock.Now().Sub(start), ShouldEqual, 2*time.Second)
+				// limit is shared, so there is no burst for next transfer
+				download()
+				So(clock.Now().Sub(start), ShouldEqual, 5*time.Second)
+			})
+			Convey("Operation", func() {
+				download(RateLimit(50))
+				So(clock.Now().Sub(start), ShouldEqual, 5*time.Second)
+			})
+			Convey("Upload", func() {
+				So(c.Upload(bytes.NewReader(make([]byte, 300)), "c", "o", "", RateLimit(50)), ShouldBeNil)
+				So(clock.Now().Sub(start), ShouldEqual, 5*time.Second)
+			})
+		})
+	})
+}
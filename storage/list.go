@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const (
+	queryPrefix    = "prefix"
+	queryDelimiter = "delimiter"
+	queryMarker    = "marker"
+	queryLimit     = "limit"
+	// ListLimit is maximum count of objects, that storage returns
+	// in single listing
+	ListLimit = 10000
+)
+
+var (
+	// ErrorIncompleteListing is returned by AllObjectsInfo if pages of
+	// listing do not advance
+	ErrorIncompleteListing = errors.New("Listing is incomplete")
+)
+
+// ListOptions are parameters of object listing
+type ListOptions struct {
+	// Prefix limits listing to objects with names, that start with it
+	Prefix string
+	// Delimiter groups objects with names, that contain it after prefix,
+	// to single ObjectInfo with Subdir, e.g. "/" lists pseudo-directory
+	Delimiter string
+	// Marker lists objects with names after it
+	Marker string
+	// Limit is maximal count of listed objects, storage returns at most
+	// ListLimit objects if it is not set
+	Limit int
+}
+
+// ListOption configures object listing
+type ListOption func(o *ListOptions)
+
+// Prefix lists objects with names, that start with prefix
+func Prefix(prefix string) ListOption {
+	return func(o *ListOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// Delimiter lists objects, that have delimiter in name after prefix,
+// as pseudo-directories
+func Delimiter(delimiter string) ListOption {
+	return func(o *ListOptions) {
+		o.Delimiter = delimiter
+	}
+}
+
+// Marker lists objects with names after marker, e.g. name of last object
+// of previous page
+func Marker(marker string) ListOption {
+	return func(o *ListOptions) {
+		o.Marker = marker
+	}
+}
+
+// Limit lists at most n objects
+func Limit(n int) ListOption {
+	return func(o *ListOptions) {
+		o.Limit = n
+	}
+}
+
+// NewListOptions returns options of listing, e.g. for implementations
+// of API
+func NewListOptions(opts ...ListOption) ListOptions {
+	var o ListOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// apply adds options to query of listing
+func (o ListOptions) apply(query url.Values) {
+	if !blank(o.Prefix) {
+		query.Set(queryPrefix, o.Prefix)
+	}
+	if !blank(o.Delimiter) {
+		query.Set(queryDelimiter, o.Delimiter)
+	}
+	if !blank(o.Marker) {
+		query.Set(queryMarker, o.Marker)
+	}
+	if o.Limit > 0 {
+		query.Set(queryLimit, strconv.Itoa(o.Limit))
+	}
+}
+
+// key returns name of object or pseudo-directory, that is used as marker
+func key(info ObjectInfo) string {
+	if blank(info.Name) {
+		return info.Subdir
+	}
+	return info.Name
+}
+
+// AllObjectsInfo returns all objects of listing of container, that is
+// requested by pages of Limit objects, ListLimit by default, starting
+// after Marker until short page is returned
+func AllObjectsInfo(container ContainerAPI, opts ...ListOption) ([]ObjectInfo, error) {
+	o := NewListOptions(opts...)
+	if o.Limit <= 0 {
+		o.Limit = ListLimit
+	}
+	info := []ObjectInfo{}
+	for {
+		page, err := container.ObjectsInfo(Prefix(o.Prefix), Delimiter(o.Delimiter), Marker(o.Marker), Limit(o.Limit))
+		if err != nil {
+			return nil, err
+		}
+		marker := o.Marker
+		for _, object := range page {
+			// pseudo-directory of marker can be listed again
+			if !blank(marker) && key(object) <= marker {
+				continue
+			}
+			info = append(info, object)
+			o.Marker = key(object)
+		}
+		if len(page) < o.Limit {
+			return info, nil
+		}
+		if o.Marker == marker {
+			return nil, ErrorIncompleteListing
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// LevelDebug is log level of requests, that is enabled by Debug(true)
+	LevelDebug = slog.LevelDebug
+	// LevelInfo is default log level, e.g. for authentication
+	LevelInfo = slog.LevelInfo
+	// LevelWarn is log level of failures, that do not fail requests
+	LevelWarn = slog.LevelWarn
+	redacted  = "REDACTED"
+)
+
+// sensitiveParams are query parameters, that are redacted in logs
+var sensitiveParams = []string{"temp_url_sig", "x-auth-token", "token"}
+
+// Logger is structured logger, e.g. *slog.Logger.
+// Arguments are alternating keys and values.
+type Logger interface {
+	Log(ctx context.Context, level slog.Level, msg string, args ...interface{})
+}
+
+// defaultLogger writes all levels to stderr, client level filters records
+func defaultLogger() Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: LevelDebug}))
+}
+
+// Debug sets log level to LevelDebug, so all requests are logged,
+// or back to level of WithLogLevel, LevelInfo by default
+func (c *Client) Debug(debug bool) {
+	c.debugging.Store(debug)
+}
+
+// minLevel returns minimal level of written records
+func (c *Client) minLevel() slog.Level {
+	if c.debugging.Load() && c.level > LevelDebug {
+		return LevelDebug
+	}
+	return c.level
+}
+
+func (c *Client) debug() bool {
+	return c.minLevel() <= LevelDebug
+}
+
+// log writes record if level is enabled
+func (c *Client) log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	if level < c.minLevel() {
+		return
+	}
+	c.logger.Log(ctx, level, msg, args...)
+}
+
+// logRequest writes record about performed request with redacted url
+func (c *Client) logRequest(request *http.Request, res *http.Response, err error, duration time.Duration, attempt int) {
+	if !c.debug() {
+		return
+	}
+	args := []interface{}{
+		"method", request.Method,
+		"operation", RequestOperation(request),
+		"url", redactURL(request.URL),
+		"duration", duration,
+		"attempt", attempt,
+	}
+	if request.ContentLength > 0 {
+		args = append(args, "bytes_sent", request.ContentLength)
+	}
+	if err != nil {
+		args = append(args, "error", err.Error())
+		c.log(request.Context(), LevelDebug, "request failed", args...)
+		return
+	}
+	args = append(args, "status", res.StatusCode)
+	if res.ContentLength >= 0 {
+		args = append(args, "bytes_received", res.ContentLength)
+	}
+	c.log(request.Context(), LevelDebug, "request", args...)
+}
+
+// redactURL returns url without password and sensitive query parameters
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	clean := *u
+	if _, ok := clean.User.Password(); ok {
+		clean.User = url.UserPassword(clean.User.Username(), redacted)
+	}
+	if clean.RawQuery != "" {
+		query := clean.Query()
+		for key := range query {
+			for _, param := range sensitiveParams {
+				if strings.EqualFold(key, param) {
+					query.Set(key, redacted)
+				}
+			}
+		}
+		clean.RawQuery = query.Encode()
+	}
+	return clean.String()
+}
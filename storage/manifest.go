@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"net/url"
+	"strings"
+)
+
+const manifestHeader = "X-Object-Manifest"
+
+// Manifest uploads object as manifest of segmented object, data of
+// object is concatenation of segments, that are objects with names
+// starting with prefix in container, sorted by name. Segments are in
+// form "container/prefix" and must be uploaded before manifest is read,
+// container and prefix are URL-encoded on upload
+func Manifest(segments string) TransferOption {
+	return func(t *transfer) {
+		t.manifest = segments
+	}
+}
+
+// RequestedManifest returns segments of manifest, that are requested by
+// options, e.g. for implementations of API
+func RequestedManifest(opts ...TransferOption) string {
+	return newTransfer(opts, SystemClock).manifest
+}
+
+// escapeManifest URL-encodes every element of segments
+func escapeManifest(segments string) string {
+	elements := strings.Split(segments, "/")
+	for i, element := range elements {
+		elements[i] = url.PathEscape(element)
+	}
+	return strings.Join(elements, "/")
+}
+
+// unescapeManifest returns segments of manifest header as is on error
+func unescapeManifest(header string) string {
+	segments, err := url.PathUnescape(header)
+	if err != nil {
+		return header
+	}
+	return segments
+}
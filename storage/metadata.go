@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"net/http"
+	"strings"
+)
+
+const objectMetaPrefix = "X-Object-Meta-"
+
+// Metadata adds metadata with key to uploaded object, keys are
+// canonicalized like header keys, e.g. "Original-Size"
+func Metadata(key, value string) TransferOption {
+	return func(t *transfer) {
+		if t.metadata == nil {
+			t.metadata = make(map[string]string)
+		}
+		t.metadata[http.CanonicalHeaderKey(key)] = value
+	}
+}
+
+// RequestedMetadata returns metadata, that is requested by options, e.g.
+// for implementations of API
+func RequestedMetadata(opts ...TransferOption) map[string]string {
+	return newTransfer(opts, SystemClock).metadata
+}
+
+// setMetadata adds headers of metadata to request
+func (t *transfer) setMetadata(header http.Header) {
+	for key, value := range t.metadata {
+		header.Set(objectMetaPrefix+key, value)
+	}
+}
+
+// parseMetadata returns metadata from headers of object or nil
+func parseMetadata(header http.Header) map[string]string {
+	var metadata map[string]string
+	for key := range header {
+		if !strings.HasPrefix(key, objectMetaPrefix) || len(key) == len(objectMetaPrefix) {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[strings.TrimPrefix(key, objectMetaPrefix)] = header.Get(key)
+	}
+	return metadata
+}
@@ -0,0 +1,257 @@
+// Package metrics collects request metrics of storage client and exposes
+// them in Prometheus text format.
+//
+//	collector := metrics.New()
+//	api, err := storage.New(user, key, storage.WithInterceptors(collector.Interceptor()))
+//	http.Handle("/metrics", collector)
+package metrics
+
+import (
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Namespace is prefix of metric names
+	Namespace = "selectel_storage"
+	// StatusError is status class of requests, that failed without response
+	StatusError = "error"
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// DefaultBuckets are upper bounds of latency histogram in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// labels of metric
+type labels struct {
+	operation string
+	status    string
+}
+
+func (l labels) String() string {
+	return fmt.Sprintf("operation=%q,status=%q", l.operation, l.status)
+}
+
+// series is all metrics with same labels
+type series struct {
+	requests uint64
+	sent     uint64
+	received uint64
+	sum      float64
+	// counts of observations in buckets, last one is +Inf
+	counts []uint64
+}
+
+// Collector records count, latency and transferred bytes of requests,
+// labelled by operation and status class. Collector is http.Handler,
+// that serves metrics in Prometheus text format.
+type Collector struct {
+	mu      sync.Mutex
+	series  map[labels]*series
+	buckets []float64
+	clock   storage.Clock
+}
+
+// Option configures Collector
+type Option func(c *Collector)
+
+// WithBuckets sets upper bounds of latency histogram in seconds
+func WithBuckets(buckets ...float64) Option {
+	return func(c *Collector) {
+		c.buckets = append([]float64{}, buckets...)
+		sort.Float64s(c.buckets)
+	}
+}
+
+// WithClock sets clock, that is used to measure latency
+func WithClock(clock storage.Clock) Option {
+	return func(c *Collector) {
+		c.clock = clock
+	}
+}
+
+// New returns empty collector
+func New(opts ...Option) *Collector {
+	c := &Collector{
+		series:  make(map[labels]*series),
+		buckets: DefaultBuckets,
+		clock:   storage.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// StatusClass returns status class of response code, e.g. 2xx
+func StatusClass(code int) string {
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// get returns series for labels, c.mu must be held
+func (c *Collector) get(l labels) *series {
+	s, ok := c.series[l]
+	if !ok {
+		s = &series{counts: make([]uint64, len(c.buckets)+1)}
+		c.series[l] = s
+	}
+	return s
+}
+
+// Observe records request of operation with status class, latency
+// and bytes sent
+func (c *Collector) Observe(operation, status string, latency time.Duration, sent int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(labels{operation, status})
+	s.requests++
+	if sent > 0 {
+		s.sent += uint64(sent)
+	}
+	seconds := latency.Seconds()
+	s.sum += seconds
+	i := sort.SearchFloat64s(c.buckets, seconds)
+	s.counts[i]++
+}
+
+// Received records bytes of response body
+func (c *Collector) Received(operation, status string, received int64) {
+	if received <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.get(labels{operation, status}).received += uint64(received)
+	c.mu.Unlock()
+}
+
+// Interceptor returns interceptor, that records requests of client.
+// Latency is measured until response headers are received, bytes are
+// counted when request and response bodies are read.
+func (c *Collector) Interceptor() storage.Interceptor {
+	return func(next storage.DoClient) storage.DoClient {
+		return storage.DoFunc(func(request *http.Request) (*http.Response, error) {
+			operation := storage.RequestOperation(request)
+			var body *countingBody
+			if request.Body != nil && request.Body != http.NoBody {
+				body = &countingBody{ReadCloser: request.Body}
+				request.Body = body
+			}
+			start := c.clock.Now()
+			res, err := next.Do(request)
+			latency := c.clock.Now().Sub(start)
+			var sent int64
+			if body != nil {
+				sent = body.count()
+			}
+			if err != nil {
+				c.Observe(operation, StatusError, latency, sent)
+				return res, err
+			}
+			status := StatusClass(res.StatusCode)
+			c.Observe(operation, status, latency, sent)
+			if res.Body != nil {
+				res.Body = &countingBody{ReadCloser: res.Body, done: func(n int64) {
+					c.Received(operation, status, n)
+				}}
+			}
+			return res, nil
+		})
+	}
+}
+
+// ServeHTTP writes metrics in Prometheus text format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	c.WriteTo(w)
+}
+
+// WriteTo writes metrics in Prometheus text format
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]labels, 0, len(c.series))
+	for l := range c.series {
+		keys = append(keys, l)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	buffer := new(strings.Builder)
+	counter := func(name, help string, value func(s *series) uint64) {
+		fmt.Fprintf(buffer, "# HELP %s_%s %s\n", Namespace, name, help)
+		fmt.Fprintf(buffer, "# TYPE %s_%s counter\n", Namespace, name)
+		for _, l := range keys {
+			fmt.Fprintf(buffer, "%s_%s{%s} %d\n", Namespace, name, l, value(c.series[l]))
+		}
+	}
+	counter("requests_total", "Count of requests.", func(s *series) uint64 { return s.requests })
+	counter("sent_bytes_total", "Bytes of request bodies.", func(s *series) uint64 { return s.sent })
+	counter("received_bytes_total", "Bytes of response bodies.", func(s *series) uint64 { return s.received })
+
+	name := Namespace + "_request_duration_seconds"
+	fmt.Fprintf(buffer, "# HELP %s Latency of requests until response headers.\n", name)
+	fmt.Fprintf(buffer, "# TYPE %s histogram\n", name)
+	for _, l := range keys {
+		s := c.series[l]
+		var cumulative uint64
+		for i, bound := range c.buckets {
+			cumulative += s.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(buffer, "%s_bucket{%s,le=%q} %d\n", name, l, le, cumulative)
+		}
+		cumulative += s.counts[len(c.buckets)]
+		fmt.Fprintf(buffer, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, cumulative)
+		fmt.Fprintf(buffer, "%s_sum{%s} %s\n", name, l, strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(buffer, "%s_count{%s} %d\n", name, l, s.requests)
+	}
+	n, err := io.WriteString(w, buffer.String())
+	return int64(n), err
+}
+
+// countingBody counts bytes read from body and reports them once
+// on EOF or close
+type countingBody struct {
+	io.ReadCloser
+	mu   sync.Mutex
+	n    int64
+	done func(n int64)
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.n += int64(n)
+	b.mu.Unlock()
+	if err == io.EOF {
+		b.report()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.report()
+	return b.ReadCloser.Close()
+}
+
+func (b *countingBody) count() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
+
+func (b *countingBody) report() {
+	b.mu.Lock()
+	done, n := b.done, b.n
+	b.done = nil
+	b.mu.Unlock()
+	if done != nil {
+		done(n)
+	}
+}
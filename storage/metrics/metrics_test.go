@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/storagetest"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Metrics", t, func() {
+		clock := storagetest.NewFakeClock(time.Now())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clock.Add(300 * time.Millisecond)
+			switch {
+			case r.URL.Path == "/auth":
+				w.Header().Set("X-Auth-Token", "token")
+				w.Header().Set("X-Expire-Auth-Token", "110")
+				w.Header().Set("X-Storage-Url", "http://"+r.Host+"/")
+				w.WriteHeader(http.StatusNoContent)
+			case r.Method == "PUT":
+				ioutil.ReadAll(r.Body)
+				w.WriteHeader(http.StatusCreated)
+			case r.Method == "GET":
+				w.Write([]byte("data"))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		collector := New(WithClock(clock), WithBuckets(1, 0.1))
+		api, err := storage.New("user", "key",
+			storage.WithAuthURL(server.URL+"/auth"),
+			storage.WithInterceptors(collector.Interceptor()),
+		)
+		So(err, ShouldBeNil)
+		output := func() string {
+			buffer := new(bytes.Buffer)
+			_, err := collector.WriteTo(buffer)
+			So(err, ShouldBeNil)
+			return buffer.String()
+		}
+		Convey("Auth", func() {
+			out := output()
+			So(out, ShouldContainSubstring, `selectel_storage_requests_total{operation="auth",status="2xx"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_request_duration_seconds_bucket{operation="auth",status="2xx",le="0.1"} 0`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_request_duration_seconds_bucket{operation="auth",status="2xx",le="1"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_request_duration_seconds_bucket{operation="auth",status="2xx",le="+Inf"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_request_duration_seconds_sum{operation="auth",status="2xx"} 0.3`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_request_duration_seconds_count{operation="auth",status="2xx"} 1`+"\n")
+			So(out, ShouldContainSubstring, "# TYPE selectel_storage_request_duration_seconds histogram\n")
+		})
+		Convey("Operations", func() {
+			So(api.Upload(bytes.NewReader([]byte("upload")), "c", "o", "text/plain"), ShouldBeNil)
+			reader, err := api.C("c").Object("o").GetReader()
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "data")
+			So(reader.Close(), ShouldBeNil)
+			_, err = api.ObjectInfo("c", "missing")
+			So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			So(api.RemoveObject("c", "missing"), ShouldEqual, storage.ErrorObjectNotFound)
+			out := output()
+			So(out, ShouldContainSubstring, `selectel_storage_requests_total{operation="upload",status="2xx"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_sent_bytes_total{operation="upload",status="2xx"} 6`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_requests_total{operation="download",status="2xx"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_received_bytes_total{operation="download",status="2xx"} 4`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_requests_total{operation="head",status="4xx"} 1`+"\n")
+			So(out, ShouldContainSubstring, `selectel_storage_requests_total{operation="delete",status="4xx"} 1`+"\n")
+		})
+		Convey("Error", func() {
+			server.Close()
+			So(api.RemoveObject("c", "o"), ShouldNotBeNil)
+			So(output(), ShouldContainSubstring, `selectel_storage_requests_total{operation="delete",status="error"} 1`+"\n")
+		})
+		Convey("Handler", func() {
+			recorder := httptest.NewRecorder()
+			collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+			So(recorder.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+			So(recorder.Body.String(), ShouldEqual, output())
+			So(strings.Count(recorder.Body.String(), "# TYPE"), ShouldEqual, 4)
+		})
+	})
+	Convey("Status class", t, func() {
+		So(StatusClass(http.StatusNoContent), ShouldEqual, "2xx")
+		So(StatusClass(http.StatusNotFound), ShouldEqual, "4xx")
+		So(StatusClass(http.StatusBadGateway), ShouldEqual, "5xx")
+	})
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -14,6 +15,7 @@ const (
 	lastModifiedLayout    = time.RFC1123
 	lastModifiedHeader    = "last-modified"
 	objectDownloadsHeader = "X-Object-Downloads"
+	rangeHeader           = "Range"
 )
 
 // ObjectInfo represents object info
@@ -25,6 +27,19 @@ type ObjectInfo struct {
 	LastModifiedStr string    `json:"last_modified"`
 	LastModified    time.Time `json:"-"`
 	Name            string    `json:"name"`
+	// Subdir is set instead of other fields for pseudo-directory
+	// of listing with delimiter
+	Subdir string `json:"subdir,omitempty"`
+	// Metadata is set by ObjectInfo, listings have no metadata
+	Metadata map[string]string `json:"-"`
+	// ContentEncoding is set by ObjectInfo, e.g. gzip for compressed object
+	ContentEncoding string `json:"-"`
+	// StoredSize is set by ObjectInfo to count of stored bytes, that is
+	// less than Size for compressed object. Size of ObjectInfo is size of
+	// data, that is read by GetReader, and listings have stored sizes
+	StoredSize uint64 `json:"-"`
+	// Manifest is set by ObjectInfo to segments of manifest object
+	Manifest string `json:"-"`
 }
 
 type Object struct {
@@ -37,13 +52,15 @@ type ObjectAPI interface {
 	Info() (ObjectInfo, error)
 	Remove() error
 	Download() ([]byte, error)
-	Upload(reader io.Reader, contentType string) error
-	UploadFile(filename string) error
-	GetReader() (io.ReadCloser, error)
+	Upload(reader io.Reader, contentType string, opts ...TransferOption) error
+	UploadFile(filename string, opts ...TransferOption) error
+	GetReader(opts ...TransferOption) (io.ReadCloser, error)
 }
 
 func (c *Client) ObjectInfo(container, filename string) (f ObjectInfo, err error) {
-	request, err := c.NewRequest(headMethod, nil, container, filename)
+	ctx, span := c.startSpan(context.Background(), "ObjectInfo", container, filename)
+	defer endSpan(span, &err)
+	request, err := c.newRequest(ctx, headMethod, nil, container, filename)
 	if err != nil {
 		return f, err
 	}
@@ -64,12 +81,23 @@ func (c *Client) ObjectInfo(container, filename string) (f ObjectInfo, err error
 	f.Size = uint64(res.ContentLength)
 	f.Hash = res.Header.Get(etagHeader)
 	f.ContentType = res.Header.Get(contentTypeHeader)
+	f.Metadata = parseMetadata(res.Header)
+	f.ContentEncoding = res.Header.Get(contentEncodingHeader)
+	f.StoredSize = f.Size
+	if manifest := res.Header.Get(manifestHeader); !blank(manifest) {
+		f.Manifest = unescapeManifest(manifest)
+	}
+	if size := originalSize(f.Metadata); compressed(f.ContentEncoding) && size >= 0 {
+		f.Size = uint64(size)
+	}
 	f.LastModified, err = time.Parse(lastModifiedLayout, res.Header.Get(lastModifiedHeader))
 	f.Name = filename
 	if err != nil {
 		return
 	}
+	f.LastModified = f.LastModified.In(c.clock.Now().Location())
 	f.Downloaded = parse(objectDownloadsHeader)
+	span.SetAttributes(Attribute{AttributeSize, f.Size})
 	return
 }
 
@@ -77,12 +105,12 @@ func (o *Object) Info() (info ObjectInfo, err error) {
 	return o.container.ObjectInfo(o.name)
 }
 
-func (o *Object) Upload(reader io.Reader, contentType string) error {
-	return o.container.Upload(reader, o.name, contentType)
+func (o *Object) Upload(reader io.Reader, contentType string, opts ...TransferOption) error {
+	return o.container.Upload(reader, o.name, contentType, opts...)
 }
 
-func (o *Object) UploadFile(filename string) error {
-	return o.container.UploadFile(filename)
+func (o *Object) UploadFile(filename string, opts ...TransferOption) error {
+	return o.container.UploadFile(filename, opts...)
 }
 
 func (o *Object) Download() ([]byte, error) {
@@ -93,19 +121,96 @@ func (o *Object) Download() ([]byte, error) {
 	return ioutil.ReadAll(reader)
 }
 
-func (o *Object) GetReader() (io.ReadCloser, error) {
-	request, _ := http.NewRequest(getMethod, o.container.URL(o.name), nil)
-	res, err := o.api.Do(request)
+func (o *Object) GetReader(opts ...TransferOption) (_ io.ReadCloser, err error) {
+	ctx, span := startObjectSpan(o.api, "GetReader", o.container.Name(), o.name)
+	defer endSpan(span, &err)
+	t := objectTransfer(o.api, opts)
+	res, err := o.get(ctx, t.ranged(), t)
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode == http.StatusNotFound {
-		return nil, ErrorObjectNotFound
+	encoding := res.Header.Get(contentEncodingHeader)
+	if compressed(encoding) && (res.StatusCode == http.StatusPartialContent ||
+		res.StatusCode == http.StatusRequestedRangeNotSatisfiable) {
+		// range of compressed data can not be decompressed and can be
+		// after end of stored data, so whole object is downloaded again
+		res.Body.Close()
+		if res, err = o.get(ctx, false, t); err != nil {
+			return nil, err
+		}
+		encoding = res.Header.Get(contentEncodingHeader)
 	}
-	if res.StatusCode != http.StatusOK {
+	body, size := res.Body, res.ContentLength
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrorObjectNotFound
+	case res.StatusCode == http.StatusRequestedRangeNotSatisfiable && !compressed(encoding):
+		// offset is after end of object
+		res.Body.Close()
+		return http.NoBody, nil
+	case res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent:
+		res.Body.Close()
 		return nil, ErrorBadResponce
 	}
-	return res.Body, nil
+	if compressed(encoding) {
+		stored := size
+		if body, err = DecompressReader(t.readCloser(body, PhaseDownload, stored), encoding); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		size = originalSize(parseMetadata(res.Header))
+	}
+	if res.StatusCode == http.StatusOK && t.ranged() {
+		// range is ignored by server or data is decompressed, so it is
+		// applied to whole object
+		if body, size, err = skip(body, size, t.offset, t.length); err != nil {
+			return nil, err
+		}
+	}
+	if size >= 0 {
+		span.SetAttributes(Attribute{AttributeSize, size})
+	}
+	if compressed(encoding) {
+		// progress and rate limit are applied to stored data
+		return body, nil
+	}
+	return t.readCloser(body, PhaseDownload, size), nil
+}
+
+// get requests data of object or its range, encoding is not negotiated,
+// so stored data is received as is
+func (o *Object) get(ctx context.Context, ranged bool, t *transfer) (*http.Response, error) {
+	request, _ := http.NewRequestWithContext(ctx, getMethod, o.container.URL(o.name), nil)
+	request.Header.Set(acceptEncodingHeader, identityEncoding)
+	if ranged {
+		request.Header.Set(rangeHeader, t.rangeHeader())
+	}
+	return o.api.Do(request)
+}
+
+// skip returns part of body with size from offset with length
+func skip(body io.ReadCloser, size, offset, length int64) (io.ReadCloser, int64, error) {
+	if _, err := io.CopyN(ioutil.Discard, body, offset); err != nil && err != io.EOF {
+		body.Close()
+		return nil, 0, err
+	}
+	if size >= 0 {
+		size -= offset
+		if size < 0 {
+			size = 0
+		}
+	}
+	if length <= 0 {
+		return body, size, nil
+	}
+	if size < 0 || length < size {
+		size = length
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(body, length), body}, size, nil
 }
 
 func (o *Object) Remove() error {
@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"reflect"
@@ -11,7 +12,7 @@ import (
 )
 
 func TestObject(t *testing.T) {
-	c := newClient(nil)
+	c := newClient()
 	Convey("Object", t, func() {
 		resp := new(http.Response)
 		resp.Header = http.Header{}
@@ -92,16 +93,19 @@ func TestObject(t *testing.T) {
 					So(reflect.DeepEqual(data, dataRead), ShouldBeTrue)
 				})
 				Convey("Not found", func() {
+					body := &closeRecorder{Reader: bytes.NewBufferString("not found")}
 					callback := func(request *http.Request) (resp *http.Response, err error) {
 						resp = new(http.Response)
 						So(request.URL.String(), ShouldEqual, "https://xxx.selcdn.ru/container/filename")
 						So(request.Method, ShouldEqual, "GET")
 						resp.StatusCode = http.StatusNotFound
+						resp.Body = body
 						return
 					}
 					c.setClient(NewTestClient(callback))
 					_, err := c.Container("container").Object("filename").GetReader()
 					So(err, ShouldEqual, ErrorObjectNotFound)
+					So(body.closed, ShouldBeTrue)
 				})
 				Convey("Bad responce", func() {
 					callback := func(request *http.Request) (resp *http.Response, err error) {
@@ -120,6 +124,54 @@ func TestObject(t *testing.T) {
 					_, err := c.Container("container").Object("filename").GetReader()
 					So(err, ShouldEqual, ErrorAuth)
 				})
+				Convey("Range", func() {
+					var (
+						ranges  []string
+						partial = true
+					)
+					callback := func(request *http.Request) (resp *http.Response, err error) {
+						resp = new(http.Response)
+						resp.Header = http.Header{}
+						So(request.Method, ShouldEqual, "GET")
+						ranges = append(ranges, request.Header.Get("Range"))
+						switch {
+						case request.Header.Get("Range") == "bytes=1024-":
+							resp.StatusCode = http.StatusRequestedRangeNotSatisfiable
+						case partial:
+							resp.StatusCode = http.StatusPartialContent
+							resp.ContentLength = 10
+							resp.Body = ioutil.NopCloser(bytes.NewBuffer(data[100:110]))
+						default:
+							resp.StatusCode = http.StatusOK
+							resp.ContentLength = int64(len(data))
+							resp.Body = ioutil.NopCloser(bytes.NewBuffer(data))
+						}
+						return
+					}
+					c.setClient(NewTestClient(callback))
+					object := c.Container("container").Object("filename")
+					read := func(opts ...TransferOption) []byte {
+						reader, err := object.GetReader(opts...)
+						So(err, ShouldBeNil)
+						dataRead, err := ioutil.ReadAll(reader)
+						So(err, ShouldBeNil)
+						return dataRead
+					}
+					So(read(Range(100, 10)), ShouldResemble, data[100:110])
+					So(ranges, ShouldResemble, []string{"bytes=100-109"})
+					So(read(Range(1024, 0)), ShouldBeEmpty)
+					So(ranges[1], ShouldEqual, "bytes=1024-")
+					Convey("Ignored", func() {
+						partial = false
+						So(read(Range(100, 10)), ShouldResemble, data[100:110])
+						So(read(Range(500, 0)), ShouldResemble, data[500:])
+						So(read(), ShouldResemble, data)
+						So(ranges[len(ranges)-1], ShouldEqual, "")
+					})
+					offset, length := RequestedRange(Range(5, 6), RateLimit(1))
+					So(offset, ShouldEqual, 5)
+					So(length, ShouldEqual, 6)
+				})
 			})
 		})
 		Convey("Info", func() {
@@ -141,6 +193,8 @@ func TestObject(t *testing.T) {
 					resp.ContentLength = 1024
 					resp.Header.Set("Content-Type", "application/octet-stream")
 					resp.Header.Set("last-modified", "Mon, 21 May 2013 12:27:11 GMT")
+					resp.Header.Set("X-Object-Meta-Original-Size", "2048")
+					resp.Header.Set("X-Object-Manifest", "my%20segments/file/")
 					resp.StatusCode = http.StatusOK
 					return
 				}
@@ -158,6 +212,9 @@ func TestObject(t *testing.T) {
 				So(info.Hash, ShouldEqual, "0f343b0931126a20f133d67c2b018a3b")
 				So(info.Downloaded, ShouldEqual, 17)
 				So(info.Size, ShouldEqual, 1024)
+				So(info.Metadata, ShouldResemble, map[string]string{"Original-Size": "2048"})
+				So(info.Manifest, ShouldEqual, "my segments/file/")
+				So(info.StoredSize, ShouldEqual, 1024)
 				Convey("Shortcut", func() {
 					info, err := c.Container("container").Object("filename").Info()
 					So(err, ShouldBeNil)
@@ -239,3 +296,14 @@ func TestObject(t *testing.T) {
 		})
 	})
 }
+
+// closeRecorder is response body, that records Close call
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
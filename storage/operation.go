@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+)
+
+// Operations of requests, see RequestOperation
+const (
+	OperationAuth     = "auth"
+	OperationUpload   = "upload"
+	OperationDownload = "download"
+	OperationList     = "list"
+	OperationHead     = "head"
+	OperationDelete   = "delete"
+	OperationCreate   = "create"
+	OperationUpdate   = "update"
+	OperationOther    = "other"
+)
+
+// operationKey is context key of request operation
+type operationKey struct{}
+
+// withOperation returns request with operation in context
+func withOperation(request *http.Request, operation string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), operationKey{}, operation))
+}
+
+// RequestOperation returns operation of request, e.g. OperationUpload,
+// so interceptors can label requests. Operation is set by client for
+// requests created by NewRequest and authentication, for other requests
+// it depends on method.
+func RequestOperation(request *http.Request) string {
+	if operation, ok := request.Context().Value(operationKey{}).(string); ok {
+		return operation
+	}
+	switch request.Method {
+	case putMethod:
+		return OperationUpload
+	case getMethod:
+		if request.URL.Query().Get(queryFormat) != "" {
+			return OperationList
+		}
+		return OperationDownload
+	case headMethod:
+		return OperationHead
+	case deleteMethod:
+		return OperationDelete
+	case postMethod:
+		return OperationUpdate
+	}
+	return OperationOther
+}
+
+// operation returns operation of request to account, container or object,
+// depending on count of path parameters
+func operation(method string, params int) string {
+	switch {
+	case method == putMethod && params < 2:
+		return OperationCreate
+	case method == getMethod && params < 2:
+		return OperationList
+	case method == getMethod:
+		return OperationDownload
+	}
+	return RequestOperation(&http.Request{Method: method})
+}
+
+// operationInterceptor sets operation of all requests
+func operationInterceptor(operation string) Interceptor {
+	return func(next DoClient) DoClient {
+		return DoFunc(func(request *http.Request) (*http.Response, error) {
+			return next.Do(withOperation(request, operation))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"testing"
+)
+
+func TestOperation(t *testing.T) {
+	Convey("Operation", t, func() {
+		c := newClient()
+		Convey("New request", func() {
+			cases := []struct {
+				method    string
+				params    []string
+				operation string
+			}{
+				{putMethod, []string{"c", "o"}, OperationUpload},
+				{putMethod, []string{"c"}, OperationCreate},
+				{getMethod, []string{"c", "o"}, OperationDownload},
+				{getMethod, []string{"c"}, OperationList},
+				{getMethod, nil, OperationList},
+				{headMethod, []string{"c", "o"}, OperationHead},
+				{deleteMethod, []string{"c"}, OperationDelete},
+				{postMethod, []string{"c", "o"}, OperationUpdate},
+			}
+			for _, test := range cases {
+				request, err := c.NewRequest(test.method, nil, test.params...)
+				So(err, ShouldBeNil)
+				So(RequestOperation(request), ShouldEqual, test.operation)
+			}
+		})
+		Convey("Other requests", func() {
+			request, err := http.NewRequest(getMethod, "https://xxx.selcdn.ru/c?format=json", nil)
+			So(err, ShouldBeNil)
+			So(RequestOperation(request), ShouldEqual, OperationList)
+			request, err = http.NewRequest(getMethod, "https://xxx.selcdn.ru/c/o", nil)
+			So(err, ShouldBeNil)
+			So(RequestOperation(request), ShouldEqual, OperationDownload)
+			request, err = http.NewRequest("PATCH", "https://xxx.selcdn.ru/c/o", nil)
+			So(err, ShouldBeNil)
+			So(RequestOperation(request), ShouldEqual, OperationOther)
+		})
+		Convey("Auth", func() {
+			var operations []string
+			callback := func(request *http.Request) (*http.Response, error) {
+				operations = append(operations, RequestOperation(request))
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			c := NewAsync("user", "key", WithHTTPClient(NewTestClient(callback)))
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(operations, ShouldResemble, []string{OperationAuth, OperationDelete})
+		})
+	})
+}
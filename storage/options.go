@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvAuthURL is environmental variable for auth endpoint url
+	EnvAuthURL = "SELECTEL_AUTH_URL"
+	// EnvAuthMode is environmental variable for auth mode, see AuthModeTempAuth
+	EnvAuthMode = "SELECTEL_AUTH_MODE"
+	// AuthModeTempAuth is EnvAuthMode value for OpenStack Swift TempAuth
+	AuthModeTempAuth = "tempauth"
+)
+
+// Option configures Client on creation
+type Option func(c *Client)
+
+// WithHTTPClient sets client that performs http requests, e.g. *http.Client
+func WithHTTPClient(client DoClient) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithTimeout sets time limit for requests made by http client,
+// including reading of response body
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithTransport sets transport of http client, e.g. to use proxy or custom CA
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithUserAgent sets User-Agent header for all requests
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithLogger sets structured logger, e.g. *slog.Logger, instead of
+// text logger, that writes to stderr
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithLogLevel sets minimal level of records, e.g. LevelDebug to log
+// all requests or LevelWarn to log only failures
+func WithLogLevel(level slog.Level) Option {
+	return func(c *Client) {
+		c.level = level
+	}
+}
+
+// WithAuthURL sets auth endpoint url instead of selectel one
+func WithAuthURL(url string) Option {
+	return func(c *Client) {
+		c.authURL = url
+	}
+}
+
+// WithTempAuth enables compatibility with stock OpenStack Swift
+// with TempAuth (v1) authentication, e.g. local SAIO installation
+func WithTempAuth() Option {
+	return func(c *Client) {
+		c.tempAuth = true
+	}
+}
+
+// WithAuthenticator sets authenticator, that is used instead of
+// selectel auth, e.g. KeystoneAuth
+func WithAuthenticator(authenticator Authenticator) Option {
+	return func(c *Client) {
+		c.authenticator = authenticator
+	}
+}
+
+// WithTokenStore sets store, that is used to load token before
+// authentication and to save it after
+func WithTokenStore(store TokenStore) Option {
+	return func(c *Client) {
+		c.store = store
+	}
+}
+
+// WithCredentialsProvider sets provider of credentials, that are used for
+// authentication when client has no own credentials, e.g. after expiration
+// of token restored from store
+func WithCredentialsProvider(provider CredentialsProvider) Option {
+	return func(c *Client) {
+		c.provider = provider
+	}
+}
+
+// WithClock sets clock, that is used instead of SystemClock,
+// e.g. to test token expiration without sleeps
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// envOptions returns options that are set in environment
+func envOptions() []Option {
+	opts := []Option{}
+	if url := os.Getenv(EnvAuthURL); !blank(url) {
+		opts = append(opts, WithAuthURL(url))
+	}
+	if strings.ToLower(os.Getenv(EnvAuthMode)) == AuthModeTempAuth {
+		opts = append(opts, WithTempAuth())
+	}
+	return opts
+}
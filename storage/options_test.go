@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"log/slog"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+type testRecord struct {
+	level  slog.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type testLogger struct {
+	records []testRecord
+}
+
+func (l *testLogger) Log(ctx context.Context, level slog.Level, msg string, args ...interface{}) {
+	record := testRecord{level: level, msg: msg, fields: map[string]interface{}{}}
+	for i := 0; i+1 < len(args); i += 2 {
+		record.fields[args[i].(string)] = args[i+1]
+	}
+	l.records = append(l.records, record)
+}
+
+func TestOptions(t *testing.T) {
+	Convey("Options", t, func() {
+		Convey("Default", func() {
+			c := newClient()
+			So(c.authURL, ShouldEqual, "https://auth.selcdn.ru/")
+			So(c.tempAuth, ShouldBeFalse)
+		})
+		Convey("HTTP client", func() {
+			Convey("Default", func() {
+				c := newClient()
+				client, ok := c.client.(*http.Client)
+				So(ok, ShouldBeTrue)
+				So(client.Timeout, ShouldEqual, 0)
+				So(client.Transport, ShouldBeNil)
+			})
+			Convey("Timeout and transport", func() {
+				transport := &http.Transport{}
+				c := newClient(WithTimeout(time.Second), WithTransport(transport))
+				client := c.client.(*http.Client)
+				So(client.Timeout, ShouldEqual, time.Second)
+				So(client.Transport, ShouldEqual, transport)
+			})
+			Convey("Custom", func() {
+				custom := &http.Client{Timeout: time.Minute}
+				c := newClient(WithHTTPClient(custom))
+				So(c.client, ShouldEqual, custom)
+				Convey("Timeout", func() {
+					c := newClient(WithHTTPClient(custom), WithTimeout(time.Second))
+					So(c.client.(*http.Client).Timeout, ShouldEqual, time.Second)
+					So(custom.Timeout, ShouldEqual, time.Minute)
+				})
+			})
+			Convey("Mock", func() {
+				mock := NewTestClientError(nil, ErrorAuth)
+				c := newClient(WithHTTPClient(mock), WithTimeout(time.Second))
+				So(c.client, ShouldEqual, mock)
+			})
+		})
+		Convey("User agent", func() {
+			callback := func(request *http.Request) (*http.Response, error) {
+				So(request.Header.Get("User-Agent"), ShouldEqual, "selctl/1.1")
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				resp.StatusCode = http.StatusForbidden
+				return resp, nil
+			}
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithUserAgent("selctl/1.1"))
+			So(c.Auth("user", "key"), ShouldEqual, ErrorAuth)
+		})
+		Convey("Logger", func() {
+			logger := new(testLogger)
+			resp := new(http.Response)
+			resp.StatusCode = http.StatusForbidden
+			c := newClient(WithHTTPClient(NewTestClientSimple(resp)), WithLogger(logger))
+			c.Debug(true)
+			So(c.Auth("user", "key"), ShouldEqual, ErrorAuth)
+			So(logger.records, ShouldHaveLength, 1)
+			So(logger.records[0].fields["method"], ShouldEqual, "GET")
+			So(logger.records[0].fields["url"], ShouldEqual, "https://auth.selcdn.ru/")
+			So(logger.records[0].fields["status"], ShouldEqual, 403)
+			Convey("Level", func() {
+				c := newClient(WithHTTPClient(NewTestClientSimple(resp)), WithLogger(logger), WithLogLevel(LevelWarn))
+				So(c.minLevel(), ShouldEqual, LevelWarn)
+				c.Debug(true)
+				So(c.minLevel(), ShouldEqual, LevelDebug)
+				c.Debug(false)
+				So(c.minLevel(), ShouldEqual, LevelWarn)
+			})
+		})
+		Convey("Env", func() {
+			defer os.Unsetenv(EnvAuthURL)
+			defer os.Unsetenv(EnvAuthMode)
+			So(len(envOptions()), ShouldEqual, 0)
+			os.Setenv(EnvAuthURL, "http://127.0.0.1:8080/auth/v1.0")
+			os.Setenv(EnvAuthMode, "TempAuth")
+			c := newClient(envOptions()...)
+			So(c.authURL, ShouldEqual, "http://127.0.0.1:8080/auth/v1.0")
+			So(c.tempAuth, ShouldBeTrue)
+			Convey("Override", func() {
+				c := newClient(append(envOptions(), WithAuthURL("http://localhost/auth"))...)
+				So(c.authURL, ShouldEqual, "http://localhost/auth")
+			})
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// Phases of transfer, see Progress
+const (
+	// PhaseHash is copying of uploaded data to temporary file with
+	// calculation of md5, that precedes upload
+	PhaseHash     = "hash"
+	PhaseUpload   = "upload"
+	PhaseDownload = "download"
+)
+
+// Progress is state of transfer phase
+type Progress struct {
+	Phase string
+	// Done is count of bytes, that are transferred in phase
+	Done int64
+	// Total is count of bytes of phase or -1 if it is unknown
+	Total int64
+	// Rate is average bytes per second since start of phase
+	Rate float64
+}
+
+// ProgressFunc is called after each read of transfer and on its end,
+// it must not block because transfer waits for it
+type ProgressFunc func(p Progress)
+
+// OnProgress sets callback, that reports progress of upload, including
+// hashing, or of download. Upload is reported from start if it is
+// replayed after authentication.
+func OnProgress(callback ProgressFunc) TransferOption {
+	return func(t *transfer) {
+		t.progress = callback
+	}
+}
+
+// progressReader reports bytes read from r
+type progressReader struct {
+	r        io.Reader
+	clock    Clock
+	start    time.Time
+	progress Progress
+	callback ProgressFunc
+	done     bool
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.done {
+		return n, err
+	}
+	r.progress.Done += int64(n)
+	if elapsed := r.clock.Now().Sub(r.start).Seconds(); elapsed > 0 {
+		r.progress.Rate = float64(r.progress.Done) / elapsed
+	}
+	if err == io.EOF {
+		r.done = true
+		r.progress.Total = r.progress.Done
+	}
+	if n > 0 || r.done {
+		r.callback(r.progress)
+	}
+	return n, err
+}
+
+// size returns length of reader if it is known or -1
+func size(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len())
+	case interface{ Stat() (os.FileInfo, error) }:
+		if stats, err := r.Stat(); err == nil && stats.Mode().IsRegular() {
+			return stats.Size()
+		}
+	}
+	return -1
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	Convey("Progress", t, func() {
+		clock := &sleepClock{testClock: newTestClock()}
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			if request.Method == putMethod {
+				ioutil.ReadAll(request.Body)
+				resp.StatusCode = http.StatusCreated
+				return resp, nil
+			}
+			resp.StatusCode = http.StatusOK
+			resp.ContentLength = 300
+			resp.Body = ioutil.NopCloser(bytes.NewReader(make([]byte, 300)))
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		var reports []Progress
+		progress := OnProgress(func(p Progress) {
+			reports = append(reports, p)
+		})
+		last := func(phase string) (p Progress) {
+			for _, report := range reports {
+				if report.Phase == phase {
+					p = report
+				}
+			}
+			return p
+		}
+		Convey("Upload", func() {
+			So(c.Upload(bytes.NewReader(make([]byte, 300)), "c", "o", "", progress, RateLimit(100)), ShouldBeNil)
+			So(reports[0].Phase, ShouldEqual, PhaseHash)
+			So(reports[0].Total, ShouldEqual, 300)
+			So(last(PhaseHash), ShouldResemble, Progress{Phase: PhaseHash, Done: 300, Total: 300})
+			So(last(PhaseUpload), ShouldResemble, Progress{Phase: PhaseUpload, Done: 300, Total: 300, Rate: 150})
+			So(reports[len(reports)-1].Phase, ShouldEqual, PhaseUpload)
+		})
+		Convey("Unknown size", func() {
+			reader := io.MultiReader(strings.NewReader("hello "), strings.NewReader("world"))
+			So(c.Upload(reader, "c", "o", "", progress), ShouldBeNil)
+			// bytes, that are read by sniffing of content type, are hashed at once
+			So(reports[0], ShouldResemble, Progress{Phase: PhaseHash, Done: 11, Total: -1})
+			So(last(PhaseHash), ShouldResemble, Progress{Phase: PhaseHash, Done: 11, Total: 11})
+			So(last(PhaseUpload).Total, ShouldEqual, 11)
+			So(last(PhaseUpload).Done, ShouldEqual, 11)
+		})
+		Convey("Download", func() {
+			reader, err := c.C("c").Object("o").GetReader(progress, RateLimit(100))
+			So(err, ShouldBeNil)
+			So(reports, ShouldBeEmpty)
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(data, ShouldHaveLength, 300)
+			So(reports[0].Done, ShouldEqual, 100)
+			So(last(PhaseDownload), ShouldResemble, Progress{Phase: PhaseDownload, Done: 300, Total: 300, Rate: 150})
+		})
+	})
+	Convey("Size", t, func() {
+		So(size(bytes.NewReader([]byte("data"))), ShouldEqual, 4)
+		So(size(strings.NewReader("data")), ShouldEqual, 4)
+		So(size(bytes.NewBufferString("data")), ShouldEqual, 4)
+		f, err := ioutil.TempFile("", "progress")
+		So(err, ShouldBeNil)
+		defer os.Remove(f.Name())
+		defer f.Close()
+		f.WriteString("data")
+		So(size(f), ShouldEqual, 4)
+		r, w, err := os.Pipe()
+		So(err, ShouldBeNil)
+		defer r.Close()
+		defer w.Close()
+		So(size(r), ShouldEqual, -1)
+		So(size(io.MultiReader()), ShouldEqual, -1)
+	})
+}
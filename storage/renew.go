@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// renewRetryInterval is delay before next renewal attempt after failure
+	renewRetryInterval = 10 * time.Second
+)
+
+// RenewalEvent is emitted by background renewer when token refresh fails
+type RenewalEvent struct {
+	// Err is error of refresh
+	Err error
+	// Expires is expiration time of current token
+	Expires time.Time
+	// Retry is time of next refresh attempt
+	Retry time.Time
+}
+
+// renewal is state of background token renewer
+type renewal struct {
+	before  time.Duration
+	retry   time.Duration
+	handler func(RenewalEvent)
+	wake    chan struct{}
+	done    chan struct{}
+	// ctx is context of refresh, that is canceled by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+	start  sync.Once
+	stop   sync.Once
+	wg     sync.WaitGroup
+}
+
+func (r *renewal) init() {
+	r.retry = renewRetryInterval
+	r.wake = make(chan struct{}, 1)
+	r.done = make(chan struct{})
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+}
+
+// WithRenewal enables background token renewal, that refreshes token
+// before time before it expires, so requests do not wait for auth.
+// Renewer is started after first authentication and is stopped by Close.
+// Handler is called from renewer on refresh failures and must not call Close,
+// failures are logged if handler is nil.
+func WithRenewal(before time.Duration, handler func(RenewalEvent)) Option {
+	return func(c *Client) {
+		c.renewal.before = before
+		c.renewal.handler = handler
+	}
+}
+
+// Close stops background token renewal, cancels refresh in progress and
+// waits for renewer to exit, Client is io.Closer, that is not part of API
+func (c *Client) Close() error {
+	c.renewal.stop.Do(func() {
+		close(c.renewal.done)
+		c.renewal.cancel()
+	})
+	c.renewal.wg.Wait()
+	return nil
+}
+
+// reschedule starts renewer or wakes it up to schedule renewal of new token,
+// c.mu must be held
+func (c *Client) reschedule() {
+	r := &c.renewal
+	if r.before <= 0 {
+		return
+	}
+	r.start.Do(func() {
+		r.wg.Add(1)
+		go c.renew()
+	})
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// renewAt returns time of token refresh and false if there is no token
+func (c *Client) renewAt() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.expireFrom == nil || blank(c.token) {
+		return time.Time{}, false
+	}
+	return c.expires().Add(-c.renewal.before), true
+}
+
+// expires returns expiration time of token, c.mu must be held
+func (c *Client) expires() time.Time {
+	if c.expireFrom == nil {
+		return time.Time{}
+	}
+	return c.expireFrom.Add(time.Duration(c.tokenExpire) * time.Second)
+}
+
+// renew refreshes token until Close is called
+func (c *Client) renew() {
+	r := &c.renewal
+	defer r.wg.Done()
+	var retry time.Time
+	for {
+		refresh, closed := c.wait(retry)
+		if closed {
+			return
+		}
+		if !refresh {
+			// token was changed, schedule renewal of new one
+			retry = time.Time{}
+			continue
+		}
+		if err := c.refresh(); err != nil {
+			retry = c.clock.Now().Add(r.retry)
+			c.renewalFailed(RenewalEvent{Err: err, Expires: c.expiration(), Retry: retry})
+		}
+	}
+}
+
+// wait blocks until token should be refreshed, but not before retry time,
+// until token is changed or until renewer is closed
+func (c *Client) wait(retry time.Time) (refresh, closed bool) {
+	var timeout <-chan time.Time
+	if next, ok := c.renewAt(); ok {
+		if next.Before(retry) {
+			next = retry
+		}
+		timer := c.clock.NewTimer(next.Sub(c.clock.Now()))
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	select {
+	case <-c.renewal.done:
+		return false, true
+	case <-c.renewal.wake:
+		return false, false
+	case <-timeout:
+		return true, false
+	}
+}
+
+// refresh obtains new token with current credentials, lock is not held
+// during authentication
+func (c *Client) refresh() error {
+	c.mu.Lock()
+	user, key, err := c.credentials()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if blank(user) || blank(key) {
+		return ErrorBadCredentials
+	}
+	return c.authenticate(c.renewal.ctx, user, key)
+}
+
+func (c *Client) expiration() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.expires()
+}
+
+func (c *Client) renewalFailed(event RenewalEvent) {
+	if c.renewal.handler != nil {
+		c.renewal.handler(event)
+		return
+	}
+	c.log(context.Background(), LevelWarn, "token renewal failed",
+		"error", event.Err.Error(), "expires", event.Expires, "retry", event.Retry)
+}
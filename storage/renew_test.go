@@ -0,0 +1,218 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRenewal(t *testing.T) {
+	Convey("Renewal", t, func() {
+		var (
+			mu    sync.Mutex
+			auths int
+			fail  bool
+		)
+		callback := func(request *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.StatusCode = http.StatusNoContent
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				if fail {
+					resp.StatusCode = http.StatusForbidden
+					return resp, nil
+				}
+				auths++
+				resp.Header.Add("X-Expire-Auth-Token", "60")
+				resp.Header.Add("X-Auth-Token", "token"+strconv.Itoa(auths))
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+			}
+			return resp, nil
+		}
+		count := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return auths
+		}
+		events := make(chan RenewalEvent, 10)
+		handler := func(e RenewalEvent) {
+			events <- e
+		}
+		event := func() (e RenewalEvent) {
+			select {
+			case e = <-events:
+			case <-time.After(5 * time.Second):
+				So("renewal has not failed", ShouldBeEmpty)
+			}
+			return e
+		}
+		clock := newTestClock()
+		before := 10 * time.Second
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithRenewal(before, handler))
+		defer c.Close()
+		// renewal timer is scheduled after every refresh
+		refresh := func() {
+			So(clock.waitTimers(1), ShouldBeTrue)
+			clock.Add(60*time.Second - before)
+			So(clock.waitTimers(1), ShouldBeTrue)
+		}
+		Convey("Refresh", func() {
+			So(c.Auth("user", "key"), ShouldBeNil)
+			So(c.Token(), ShouldEqual, "token1")
+			refresh()
+			So(c.Token(), ShouldEqual, "token2")
+			refresh()
+			So(c.Token(), ShouldEqual, "token3")
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(count(), ShouldEqual, 3)
+			Convey("Close", func() {
+				So(c.Close(), ShouldBeNil)
+				clock.Add(time.Hour)
+				So(count(), ShouldEqual, 3)
+				So(c.Close(), ShouldBeNil)
+			})
+		})
+		Convey("Failure", func() {
+			So(c.Auth("user", "key"), ShouldBeNil)
+			expires := clock.Now().Add(60 * time.Second)
+			mu.Lock()
+			fail = true
+			mu.Unlock()
+			So(clock.waitTimers(1), ShouldBeTrue)
+			clock.Add(60*time.Second - before)
+			e := event()
+			So(e.Err, ShouldEqual, ErrorAuth)
+			So(e.Expires, ShouldEqual, expires)
+			So(e.Retry, ShouldEqual, clock.Now().Add(renewRetryInterval))
+			Convey("Retry", func() {
+				So(clock.waitTimers(1), ShouldBeTrue)
+				clock.Add(renewRetryInterval)
+				So(event().Err, ShouldEqual, ErrorAuth)
+				mu.Lock()
+				fail = false
+				mu.Unlock()
+				So(clock.waitTimers(1), ShouldBeTrue)
+				clock.Add(renewRetryInterval)
+				So(clock.waitTimers(1), ShouldBeTrue)
+				So(count(), ShouldEqual, 2)
+				So(c.Token(), ShouldEqual, "token2")
+			})
+		})
+		Convey("Lazy", func() {
+			c.user, c.key = "user", "key"
+			clock.Add(time.Hour)
+			So(count(), ShouldEqual, 0)
+			So(c.RemoveObject("c", "o"), ShouldBeNil)
+			So(count(), ShouldEqual, 1)
+			refresh()
+			So(count(), ShouldEqual, 2)
+		})
+		Convey("Disabled", func() {
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock))
+			So(c.Auth("user", "key"), ShouldBeNil)
+			clock.Add(50 * time.Second)
+			So(count(), ShouldEqual, 1)
+			So(c.Close(), ShouldBeNil)
+		})
+	})
+	Convey("Hanging renewal", t, func() {
+		var (
+			mu    sync.Mutex
+			auths int
+		)
+		clock := newTestClock()
+		hang := make(chan struct{})
+		renewing := make(chan struct{})
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.StatusCode = http.StatusNoContent
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				mu.Lock()
+				auths++
+				n := auths
+				mu.Unlock()
+				if n > 1 {
+					close(renewing)
+					<-hang
+				}
+				resp.Header.Add("X-Expire-Auth-Token", "60")
+				resp.Header.Add("X-Auth-Token", "token"+strconv.Itoa(n))
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+			}
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithRenewal(10*time.Second, nil))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		So(clock.waitTimers(1), ShouldBeTrue)
+		clock.Add(50 * time.Second)
+		<-renewing
+		done := make(chan error, 1)
+		go func() {
+			done <- c.RemoveObject("c", "o")
+		}()
+		select {
+		case err := <-done:
+			So(err, ShouldBeNil)
+		case <-time.After(5 * time.Second):
+			So("request is blocked by renewal", ShouldBeEmpty)
+		}
+		So(c.Token(), ShouldEqual, "token1")
+		close(hang)
+		So(c.Close(), ShouldBeNil)
+	})
+	Convey("Close during refresh", t, func() {
+		var (
+			mu    sync.Mutex
+			auths int
+		)
+		clock := newTestClock()
+		renewing := make(chan struct{})
+		callback := func(request *http.Request) (*http.Response, error) {
+			mu.Lock()
+			auths++
+			n := auths
+			mu.Unlock()
+			if n > 1 {
+				// auth endpoint hangs until request is canceled
+				close(renewing)
+				<-request.Context().Done()
+				return nil, request.Context().Err()
+			}
+			resp := &http.Response{StatusCode: http.StatusNoContent, Header: http.Header{}}
+			resp.Header.Add("X-Expire-Auth-Token", "60")
+			resp.Header.Add("X-Auth-Token", "token")
+			resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock), WithRenewal(10*time.Second, nil))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		So(clock.waitTimers(1), ShouldBeTrue)
+		clock.Add(50 * time.Second)
+		<-renewing
+		closed := make(chan error, 1)
+		go func() {
+			closed <- c.Close()
+		}()
+		select {
+		case err := <-closed:
+			So(err, ShouldBeNil)
+		case <-time.After(5 * time.Second):
+			So("close is blocked by refresh", ShouldBeEmpty)
+		}
+	})
+	Convey("Expiration margin", t, func() {
+		now := time.Now()
+		So(expired("token", &now, 110, now), ShouldBeFalse)
+		So(expired("token", &now, 5, now), ShouldBeTrue)
+		So(expired("token", &now, 110, now.Add(99*time.Second)), ShouldBeFalse)
+		So(expired("token", &now, 110, now.Add(101*time.Second)), ShouldBeTrue)
+		So(expired("", &now, 110, now), ShouldBeTrue)
+		So(expired("token", nil, 110, now), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,83 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"github.com/ernado/selectel/storage"
+	"net/http"
+)
+
+// apiError is error of S3 API with http status and code
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errAccessDenied                 = &apiError{http.StatusForbidden, "AccessDenied", "Access Denied"}
+	errExpiredRequest               = &apiError{http.StatusForbidden, "AccessDenied", "Request has expired"}
+	errInvalidAccessKeyID           = &apiError{http.StatusForbidden, "InvalidAccessKeyId", "The access key Id you provided does not exist"}
+	errSignatureDoesNotMatch        = &apiError{http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided"}
+	errRequestTimeTooSkewed         = &apiError{http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large"}
+	errAuthorizationHeaderMalformed = &apiError{http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed"}
+	errAuthorizationQueryMalformed  = &apiError{http.StatusBadRequest, "AuthorizationQueryParametersError", "The authorization query parameters are malformed"}
+	errMissingContentSHA256         = &apiError{http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256"}
+	errContentSHA256Mismatch        = &apiError{http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed"}
+	errInvalidArgument              = &apiError{http.StatusBadRequest, "InvalidArgument", "Invalid Argument"}
+	errMalformedXML                 = &apiError{http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed"}
+	errInvalidPart                  = &apiError{http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found"}
+	errInvalidPartOrder             = &apiError{http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order"}
+	errNoSuchBucket                 = &apiError{http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist"}
+	errNoSuchKey                    = &apiError{http.StatusNotFound, "NoSuchKey", "The specified key does not exist"}
+	errNoSuchUpload                 = &apiError{http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist"}
+	errMethodNotAllowed             = &apiError{http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource"}
+	errInvalidRange                 = &apiError{http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable"}
+	errInternal                     = &apiError{http.StatusInternalServerError, "InternalError", "We encountered an internal error, please try again"}
+	errNotImplemented               = &apiError{http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented"}
+)
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+// bucketError returns NoSuchBucket for not found error of storage
+func bucketError(err error) error {
+	if err == storage.ErrorObjectNotFound {
+		return errNoSuchBucket
+	}
+	return err
+}
+
+// objectError returns NoSuchKey for not found error of storage
+func objectError(err error) error {
+	if err == storage.ErrorObjectNotFound {
+		return errNoSuchKey
+	}
+	return err
+}
+
+// writeError writes error response, errors of storage are internal
+// errors and invalid names are invalid arguments
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+	case err == storage.ErrorBadName:
+		e = errInvalidArgument
+	default:
+		e = errInternal
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.status)
+		return
+	}
+	writeXML(w, e.status, errorResponse{Code: e.code, Message: e.message, Resource: r.URL.Path})
+}
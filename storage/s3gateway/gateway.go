@@ -0,0 +1,494 @@
+// Package s3gateway serves subset of Amazon S3 REST API over storage,
+// so S3 clients and tools can be used with containers.
+//
+//	gateway := s3gateway.New(api, s3gateway.WithCredentials("access", "secret"))
+//	http.ListenAndServe(":9000", gateway)
+//
+// Buckets are containers and keys are object names, only path-style
+// requests are served. Requests must be signed by AWS Signature Version 4
+// with one of configured keys, in Authorization header or in query of
+// presigned url. Multipart uploads are stored as segments in hidden
+// container with "_segments_" prefix and completed by manifest object,
+// segments are removed with manifest.
+package s3gateway
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegion is region of credential scope, that is expected by default
+	DefaultRegion = "us-east-1"
+
+	xmlns         = "http://s3.amazonaws.com/doc/2006-03-01/"
+	timeLayout    = "2006-01-02T15:04:05.000Z"
+	maxKeys       = 1000
+	storageClass  = "STANDARD"
+	encodingURL   = "url"
+	rangePrefix   = "bytes="
+	copySource    = "X-Amz-Copy-Source"
+	contentType   = "Content-Type"
+	queryUploads  = "uploads"
+	queryUploadID = "uploadId"
+)
+
+// Gateway is http.Handler of S3 requests
+type Gateway struct {
+	api         storage.API
+	credentials map[string]string
+	region      string
+	clock       storage.Clock
+}
+
+var _ http.Handler = (*Gateway)(nil)
+
+// Option configures Gateway
+type Option func(g *Gateway)
+
+// WithCredentials adds access key with secret key, that can sign requests,
+// without credentials all requests are denied
+func WithCredentials(accessKey, secretKey string) Option {
+	return func(g *Gateway) {
+		g.credentials[accessKey] = secretKey
+	}
+}
+
+// WithRegion sets region of credential scope, DefaultRegion by default
+func WithRegion(region string) Option {
+	return func(g *Gateway) {
+		g.region = region
+	}
+}
+
+// WithClock sets clock, that is used to check time of signatures
+func WithClock(clock storage.Clock) Option {
+	return func(g *Gateway) {
+		g.clock = clock
+	}
+}
+
+// New returns gateway to storage
+func New(api storage.API, opts ...Option) *Gateway {
+	g := &Gateway{
+		api:         api,
+		credentials: make(map[string]string),
+		region:      DefaultRegion,
+		clock:       storage.SystemClock,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// ServeHTTP authenticates request and calls operation of S3 API
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := g.authenticate(r); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if err := g.serve(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// serve routes request by method, bucket, key and query
+func (g *Gateway) serve(w http.ResponseWriter, r *http.Request) error {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	bucket, key := parts[0], ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	query := r.URL.Query()
+	_, uploads := query[queryUploads]
+	uploadID := query.Get(queryUploadID)
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return g.listBuckets(w)
+	case bucket == "":
+		return errMethodNotAllowed
+	case isSegments(bucket):
+		return errNoSuchBucket
+	case key == "" && r.Method == http.MethodGet && !uploads:
+		return g.listObjects(w, bucket, query)
+	case key == "" && r.Method == http.MethodHead:
+		return g.headBucket(w, bucket)
+	case key == "":
+		return errNotImplemented
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return g.getObject(w, r, bucket, key)
+	case http.MethodPut:
+		if r.Header.Get(copySource) != "" {
+			return errNotImplemented
+		}
+		if uploadID != "" {
+			return g.uploadPart(w, r, bucket, key, uploadID)
+		}
+		return g.putObject(w, r, bucket, key)
+	case http.MethodDelete:
+		if uploadID != "" {
+			return g.abortUpload(w, bucket, key, uploadID)
+		}
+		return g.deleteObject(w, bucket, key)
+	case http.MethodPost:
+		if uploads {
+			return g.createUpload(w, r, bucket, key)
+		}
+		if uploadID != "" {
+			return g.completeUpload(w, r, bucket, key, uploadID)
+		}
+		return errNotImplemented
+	}
+	return errMethodNotAllowed
+}
+
+type owner struct {
+	ID          string
+	DisplayName string
+}
+
+type bucketInfo struct {
+	Name         string
+	CreationDate string
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+// listBuckets lists all containers, storage has no creation time of
+// containers, so it is zero unix time
+func (g *Gateway) listBuckets(w http.ResponseWriter) error {
+	containers, err := g.api.ContainersInfo()
+	if err != nil {
+		return err
+	}
+	result := listAllMyBucketsResult{Xmlns: xmlns}
+	for _, container := range containers {
+		if isSegments(container.Name) {
+			continue
+		}
+		result.Buckets = append(result.Buckets, bucketInfo{
+			Name:         container.Name,
+			CreationDate: formatTime(time.Unix(0, 0)),
+		})
+	}
+	return writeXML(w, http.StatusOK, result)
+}
+
+// headBucket checks, that container exists
+func (g *Gateway) headBucket(w http.ResponseWriter, bucket string) error {
+	if _, err := g.api.ContainerInfo(bucket); err != nil {
+		return bucketError(err)
+	}
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type objectInfo struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         uint64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	KeyCount              int            `xml:"KeyCount"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectInfo   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects implements ListObjectsV2, container is listed with prefix
+// and delimiter after marker, that is start-after or continuation token
+// with last returned key, one more key than requested is listed to find
+// out, that result is truncated
+func (g *Gateway) listObjects(w http.ResponseWriter, bucket string, query url.Values) error {
+	if query.Get("list-type") != "2" {
+		return errNotImplemented
+	}
+	result := listBucketResult{
+		Xmlns:             xmlns,
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		EncodingType:      query.Get("encoding-type"),
+		MaxKeys:           maxKeys,
+	}
+	if s := query.Get("max-keys"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return errInvalidArgument
+		}
+		if n < maxKeys {
+			result.MaxKeys = n
+		}
+	}
+	after := result.StartAfter
+	if result.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(result.ContinuationToken)
+		if err != nil {
+			return errInvalidArgument
+		}
+		after = string(token)
+	}
+	var (
+		objects []storage.ObjectInfo
+		err     error
+	)
+	if result.MaxKeys == 0 {
+		// empty page is not truncated
+		_, err = g.api.ContainerInfo(bucket)
+	} else {
+		objects, err = g.list(bucket, result.Prefix, result.Delimiter, after, result.MaxKeys+1)
+	}
+	if err != nil {
+		return bucketError(err)
+	}
+	encode := func(s string) string {
+		if result.EncodingType == encodingURL {
+			return url.QueryEscape(s)
+		}
+		return s
+	}
+	last := ""
+	for _, object := range objects {
+		name := object.Name + object.Subdir
+		if name <= after {
+			continue
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		result.KeyCount++
+		last = name
+		if object.Subdir != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: encode(object.Subdir)})
+			continue
+		}
+		result.Contents = append(result.Contents, objectInfo{
+			Key:          encode(object.Name),
+			LastModified: formatTime(object.LastModified),
+			ETag:         quote(object.Hash),
+			Size:         object.Size,
+			StorageClass: storageClass,
+		})
+	}
+	result.Prefix = encode(result.Prefix)
+	result.Delimiter = encode(result.Delimiter)
+	result.StartAfter = encode(result.StartAfter)
+	return writeXML(w, http.StatusOK, result)
+}
+
+// list returns up to n objects of bucket with names after marker, pages
+// are requested until n objects are listed, pseudo-directory of marker
+// can be listed again and is skipped
+func (g *Gateway) list(bucket, prefix, delimiter, marker string, n int) ([]storage.ObjectInfo, error) {
+	var objects []storage.ObjectInfo
+	for len(objects) < n {
+		page, err := g.api.ObjectsInfo(bucket, storage.Prefix(prefix), storage.Delimiter(delimiter),
+			storage.Marker(marker), storage.Limit(n))
+		if err != nil {
+			return nil, err
+		}
+		next := marker
+		for _, object := range page {
+			if name := object.Name + object.Subdir; name > marker && len(objects) < n {
+				objects = append(objects, object)
+				next = name
+			}
+		}
+		if len(page) < n {
+			return objects, nil
+		}
+		if next == marker {
+			return nil, storage.ErrorIncompleteListing
+		}
+		marker = next
+	}
+	return objects, nil
+}
+
+// getObject implements GetObject and HeadObject with single byte range
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	object := g.api.Container(bucket).Object(key)
+	info, err := object.Info()
+	if err != nil {
+		return objectError(err)
+	}
+	header := w.Header()
+	header.Set(contentType, info.ContentType)
+	header.Set("ETag", quote(info.Hash))
+	header.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	size := int64(info.Size)
+	offset, length, partial, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		header.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		return err
+	}
+	status := http.StatusOK
+	var opts []storage.TransferOption
+	if partial {
+		status = http.StatusPartialContent
+		opts = append(opts, storage.Range(offset, length))
+		header.Set("Content-Range", "bytes "+strconv.FormatInt(offset, 10)+"-"+
+			strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	if r.Method == http.MethodHead || length == 0 {
+		w.WriteHeader(status)
+		return nil
+	}
+	reader, err := object.GetReader(opts...)
+	if err != nil {
+		return objectError(err)
+	}
+	defer reader.Close()
+	w.WriteHeader(status)
+	// headers are sent, so error can not be reported to client
+	io.Copy(w, reader)
+	return nil
+}
+
+// parseRange returns range of object with size, invalid or multiple
+// ranges are ignored like in S3
+func parseRange(s string, size int64) (offset, length int64, partial bool, err error) {
+	if !strings.HasPrefix(s, rangePrefix) || strings.Contains(s, ",") {
+		return 0, size, false, nil
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, rangePrefix), "-", 2)
+	if len(parts) != 2 {
+		return 0, size, false, nil
+	}
+	if parts[0] == "" {
+		n, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || n < 0 {
+			return 0, size, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+	first, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || first < 0 {
+		return 0, size, false, nil
+	}
+	last := size - 1
+	if parts[1] != "" {
+		if last, err = strconv.ParseInt(parts[1], 10, 64); err != nil || last < first {
+			return 0, size, false, nil
+		}
+	}
+	if first >= size {
+		return 0, 0, false, errInvalidRange
+	}
+	if last >= size {
+		last = size - 1
+	}
+	return first, last - first + 1, true, nil
+}
+
+// putObject implements PutObject, etag of object is md5 of data
+func (g *Gateway) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	hasher := md5.New()
+	previous, _ := g.api.ObjectInfo(bucket, key)
+	if err := g.api.Upload(io.TeeReader(r.Body, hasher), bucket, key, r.Header.Get(contentType)); err != nil {
+		return g.uploadError(bucket, err)
+	}
+	if err := g.removeSegments(bucket, previous); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", quote(hex.EncodeToString(hasher.Sum(nil))))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// uploadError returns NoSuchBucket if container of failed upload does not
+// exist, storage does not distinguish it from other failures
+func (g *Gateway) uploadError(bucket string, err error) error {
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	if _, infoErr := g.api.ContainerInfo(bucket); infoErr == storage.ErrorObjectNotFound {
+		return errNoSuchBucket
+	}
+	return err
+}
+
+// deleteObject implements DeleteObject, that succeeds for missing keys,
+// segments of multipart upload are removed with manifest
+func (g *Gateway) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	previous, _ := g.api.ObjectInfo(bucket, key)
+	if err := g.api.RemoveObject(bucket, key); err != nil && err != storage.ErrorObjectNotFound {
+		return err
+	}
+	if err := g.removeSegments(bucket, previous); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// quote returns etag in quotes, storage returns etags of manifests
+// already quoted
+func quote(etag string) string {
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set(contentType, "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(status)
+	io.WriteString(w, xml.Header)
+	w.Write(data)
+	return nil
+}
@@ -0,0 +1,242 @@
+package s3gateway
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentsPrefix  = "_segments_"
+	segmentsType    = "application/octet-stream"
+	maxPartNumber   = 10000
+	uploadIDLength  = 16
+	partNumberQuery = "partNumber"
+)
+
+// segments returns name of container with segments of bucket, prefix
+// starts with underscore, that is not valid in bucket names, so
+// containers of segments do not collide with buckets
+func segments(bucket string) string {
+	return segmentsPrefix + bucket
+}
+
+// isSegments reports whether container keeps segments of other bucket
+func isSegments(container string) bool {
+	return strings.HasPrefix(container, segmentsPrefix)
+}
+
+// removeSegments removes segments of replaced or deleted object of
+// bucket, if it is manifest of upload
+func (g *Gateway) removeSegments(bucket string, info storage.ObjectInfo) error {
+	prefix := strings.TrimPrefix(info.Manifest, segments(bucket)+"/")
+	if prefix == info.Manifest || prefix == "" {
+		return nil
+	}
+	uploaded, err := g.api.ObjectsInfo(segments(bucket), storage.Prefix(prefix))
+	if err != nil {
+		return err
+	}
+	for _, object := range uploaded {
+		if err = g.api.RemoveObject(segments(bucket), object.Name); err != nil && err != storage.ErrorObjectNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// marker returns name of object, that keeps content type of upload while
+// it is in progress
+func marker(key, uploadID string) string {
+	return key + "/" + uploadID
+}
+
+// segmentPrefix returns prefix of segments of upload, that is prefix of
+// manifest
+func segmentPrefix(key, uploadID string) string {
+	return marker(key, uploadID) + "/"
+}
+
+// segment returns name of segment with part number, names are padded to
+// be sorted by number
+func segment(key, uploadID string, part int) string {
+	return fmt.Sprintf("%s%05d", segmentPrefix(key, uploadID), part)
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// createUpload implements CreateMultipartUpload, container of segments
+// is created and marker of upload is uploaded to it
+func (g *Gateway) createUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if _, err := g.api.ContainerInfo(bucket); err != nil {
+		return bucketError(err)
+	}
+	if _, err := g.api.CreateContainer(segments(bucket), true); err != nil {
+		return err
+	}
+	id := make([]byte, uploadIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	uploadID := hex.EncodeToString(id)
+	if err := g.api.Upload(strings.NewReader(""), segments(bucket), marker(key, uploadID), r.Header.Get(contentType)); err != nil {
+		return err
+	}
+	return writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Xmlns:    xmlns,
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+// upload returns marker of upload in progress
+func (g *Gateway) upload(bucket, key, uploadID string) (storage.ObjectInfo, error) {
+	info, err := g.api.ObjectInfo(segments(bucket), marker(key, uploadID))
+	if err == storage.ErrorObjectNotFound || err == storage.ErrorBadName {
+		return info, errNoSuchUpload
+	}
+	return info, err
+}
+
+// uploadPart implements UploadPart, part is uploaded as segment
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	part, err := strconv.Atoi(r.URL.Query().Get(partNumberQuery))
+	if err != nil || part < 1 || part > maxPartNumber {
+		return errInvalidArgument
+	}
+	if _, err = g.upload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	hasher := md5.New()
+	if err = g.api.Upload(io.TeeReader(r.Body, hasher), segments(bucket), segment(key, uploadID, part), segmentsType); err != nil {
+		return err
+	}
+	w.Header().Set("ETag", quote(hex.EncodeToString(hasher.Sum(nil))))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// completeUpload implements CompleteMultipartUpload, segments, that are
+// not listed in request, are removed and manifest of other segments is
+// uploaded as object. Etag of result is computed like in S3, from md5
+// of parts
+func (g *Gateway) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, uploadID string) error {
+	info, err := g.upload(bucket, key, uploadID)
+	if err != nil {
+		return err
+	}
+	var request completeMultipartUpload
+	if err = xml.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		var apiErr *apiError
+		if errors.As(err, &apiErr) {
+			return err
+		}
+		return errMalformedXML
+	}
+	uploaded, err := g.api.ObjectsInfo(segments(bucket), storage.Prefix(segmentPrefix(key, uploadID)))
+	if err != nil {
+		return err
+	}
+	hashes := make(map[string]string)
+	for _, object := range uploaded {
+		hashes[object.Name] = object.Hash
+	}
+	hasher := md5.New()
+	for i, part := range request.Parts {
+		if i > 0 && part.PartNumber <= request.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		name := segment(key, uploadID, part.PartNumber)
+		hash, ok := hashes[name]
+		if !ok || hash != strings.Trim(part.ETag, `"`) {
+			return errInvalidPart
+		}
+		digest, err := hex.DecodeString(hash)
+		if err != nil {
+			return errInvalidPart
+		}
+		hasher.Write(digest)
+		delete(hashes, name)
+	}
+	for name := range hashes {
+		if err = g.api.RemoveObject(segments(bucket), name); err != nil && err != storage.ErrorObjectNotFound {
+			return err
+		}
+	}
+	// storage URL-encodes container and prefix of manifest
+	manifest := storage.Manifest(segments(bucket) + "/" + segmentPrefix(key, uploadID))
+	previous, _ := g.api.ObjectInfo(bucket, key)
+	if err = g.api.Upload(strings.NewReader(""), bucket, key, info.ContentType, manifest); err != nil {
+		return g.uploadError(bucket, err)
+	}
+	if err = g.removeSegments(bucket, previous); err != nil {
+		return err
+	}
+	if err = g.api.RemoveObject(segments(bucket), marker(key, uploadID)); err != nil && err != storage.ErrorObjectNotFound {
+		return err
+	}
+	return writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Xmlns:    xmlns,
+		Location: "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     quote(fmt.Sprintf("%s-%d", hex.EncodeToString(hasher.Sum(nil)), len(request.Parts))),
+	})
+}
+
+// abortUpload implements AbortMultipartUpload, segments and marker of
+// upload are removed
+func (g *Gateway) abortUpload(w http.ResponseWriter, bucket, key, uploadID string) error {
+	if _, err := g.upload(bucket, key, uploadID); err != nil {
+		return err
+	}
+	uploaded, err := g.api.ObjectsInfo(segments(bucket), storage.Prefix(segmentPrefix(key, uploadID)))
+	if err != nil {
+		return err
+	}
+	names := []string{marker(key, uploadID)}
+	for _, object := range uploaded {
+		names = append(names, object.Name)
+	}
+	for _, name := range names {
+		if err = g.api.RemoveObject(segments(bucket), name); err != nil && err != storage.ErrorObjectNotFound {
+			return err
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
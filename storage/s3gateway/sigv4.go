@@ -0,0 +1,283 @@
+package s3gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	service         = "s3"
+	terminator      = "aws4_request"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	streamingPrefix = "STREAMING-"
+	amzDateLayout   = "20060102T150405Z"
+	maxSkew         = 15 * time.Minute
+	maxExpires      = 7 * 24 * time.Hour
+
+	authorizationHeader = "Authorization"
+	amzDateHeader       = "X-Amz-Date"
+	contentSHA256Header = "X-Amz-Content-Sha256"
+
+	queryAlgorithm     = "X-Amz-Algorithm"
+	queryCredential    = "X-Amz-Credential"
+	queryDate          = "X-Amz-Date"
+	queryExpires       = "X-Amz-Expires"
+	querySignedHeaders = "X-Amz-SignedHeaders"
+	querySignature     = "X-Amz-Signature"
+)
+
+// signature is parsed signature of request
+type signature struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	terminator    string
+	signedHeaders []string
+	signature     string
+	amzDate       string
+	payload       string
+	presigned     bool
+	expires       time.Duration
+}
+
+// scope returns credential scope of signature
+func (s *signature) scope() string {
+	return strings.Join([]string{s.date, s.region, s.service, s.terminator}, "/")
+}
+
+// authenticate verifies signature of request, body of request with
+// signed payload is checked while it is read
+func (g *Gateway) authenticate(r *http.Request) error {
+	var (
+		s   *signature
+		err error
+	)
+	if r.URL.Query().Get(queryAlgorithm) != "" {
+		s, err = parsePresigned(r.URL.Query())
+	} else {
+		s, err = parseAuthorization(r)
+	}
+	if err != nil {
+		return err
+	}
+	secret, ok := g.credentials[s.accessKey]
+	if !ok {
+		return errInvalidAccessKeyID
+	}
+	if s.region != g.region || s.service != service || s.terminator != terminator {
+		return errAuthorizationHeaderMalformed
+	}
+	signed, err := time.Parse(amzDateLayout, s.amzDate)
+	if err != nil || !strings.HasPrefix(s.amzDate, s.date) {
+		return errAuthorizationHeaderMalformed
+	}
+	now := g.clock.Now()
+	switch {
+	case s.presigned && now.After(signed.Add(s.expires)):
+		return errExpiredRequest
+	case signed.After(now.Add(maxSkew)), !s.presigned && signed.Before(now.Add(-maxSkew)):
+		return errRequestTimeTooSkewed
+	}
+	if !hmac.Equal([]byte(s.signature), []byte(sign(secret, s, canonicalRequest(r, s)))) {
+		return errSignatureDoesNotMatch
+	}
+	if s.payload != unsignedPayload {
+		r.Body = &payloadReader{ReadCloser: r.Body, hash: sha256.New(), expected: s.payload}
+	}
+	return nil
+}
+
+// parseAuthorization parses signature from Authorization header like
+// "AWS4-HMAC-SHA256 Credential=key/date/region/s3/aws4_request,
+// SignedHeaders=host;x-amz-date, Signature=hex"
+func parseAuthorization(r *http.Request) (*signature, error) {
+	header := r.Header.Get(authorizationHeader)
+	if header == "" {
+		return nil, errAccessDenied
+	}
+	if !strings.HasPrefix(header, algorithm+" ") {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(header, algorithm+" "), ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		fields[parts[0]] = parts[1]
+	}
+	s := &signature{
+		signature: fields["Signature"],
+		amzDate:   r.Header.Get(amzDateHeader),
+		payload:   r.Header.Get(contentSHA256Header),
+	}
+	if !s.parseCredential(fields["Credential"]) || fields["SignedHeaders"] == "" || s.signature == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	s.signedHeaders = strings.Split(fields["SignedHeaders"], ";")
+	switch {
+	case s.payload == "":
+		return nil, errMissingContentSHA256
+	case strings.HasPrefix(s.payload, streamingPrefix):
+		return nil, errNotImplemented
+	case s.payload != unsignedPayload && !validSHA256(s.payload):
+		return nil, errContentSHA256Mismatch
+	}
+	return s, nil
+}
+
+// parsePresigned parses signature from query of presigned url, payload
+// of presigned request is not signed
+func parsePresigned(query url.Values) (*signature, error) {
+	s := &signature{
+		signature: query.Get(querySignature),
+		amzDate:   query.Get(queryDate),
+		payload:   unsignedPayload,
+		presigned: true,
+	}
+	expires, err := strconv.Atoi(query.Get(queryExpires))
+	s.expires = time.Duration(expires) * time.Second
+	if err != nil || expires < 0 || s.expires > maxExpires {
+		return nil, errAuthorizationQueryMalformed
+	}
+	if query.Get(queryAlgorithm) != algorithm || !s.parseCredential(query.Get(queryCredential)) ||
+		query.Get(querySignedHeaders) == "" || s.signature == "" {
+		return nil, errAuthorizationQueryMalformed
+	}
+	s.signedHeaders = strings.Split(query.Get(querySignedHeaders), ";")
+	return s, nil
+}
+
+// parseCredential parses "key/date/region/service/aws4_request"
+func (s *signature) parseCredential(credential string) bool {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 {
+		return false
+	}
+	s.accessKey, s.date, s.region, s.service, s.terminator = parts[0], parts[1], parts[2], parts[3], parts[4]
+	return true
+}
+
+func validSHA256(s string) bool {
+	data, err := hex.DecodeString(s)
+	return err == nil && len(data) == sha256.Size
+}
+
+// canonicalRequest returns canonical form of request, that is signed
+func canonicalRequest(r *http.Request, s *signature) string {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	headers := new(strings.Builder)
+	for _, name := range s.signedHeaders {
+		headers.WriteString(name + ":" + headerValue(r, name) + "\n")
+	}
+	return strings.Join([]string{
+		r.Method,
+		escape(path, false),
+		canonicalQuery(r.URL.Query(), s.presigned),
+		headers.String(),
+		strings.Join(s.signedHeaders, ";"),
+		s.payload,
+	}, "\n")
+}
+
+// headerValue returns trimmed values of header joined by comma, host and
+// content length are not kept in header by net/http
+func headerValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if r.Header.Get(name) == "" && r.ContentLength >= 0 {
+			return strconv.FormatInt(r.ContentLength, 10)
+		}
+	}
+	var values []string
+	for _, value := range r.Header.Values(name) {
+		values = append(values, strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(values, ",")
+}
+
+// canonicalQuery returns escaped query sorted by keys and values,
+// signature of presigned url is not signed
+func canonicalQuery(query url.Values, presigned bool) string {
+	var pairs []string
+	for key, values := range query {
+		if presigned && key == querySignature {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, escape(key, true)+"="+escape(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// escape encodes all bytes except unreserved characters, slash is kept
+// unless encodeSlash is set
+func escape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	b := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// sign returns signature of canonical request
+func sign(secret string, s *signature, canonical string) string {
+	digest := sha256.Sum256([]byte(canonical))
+	stringToSign := strings.Join([]string{algorithm, s.amzDate, s.scope(), hex.EncodeToString(digest[:])}, "\n")
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{s.date, s.region, s.service, s.terminator} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	io.WriteString(h, data)
+	return h.Sum(nil)
+}
+
+// payloadReader returns error at the end of body, that does not match
+// signed sha256
+type payloadReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		return n, errContentSHA256Mismatch
+	}
+	return n, err
+}
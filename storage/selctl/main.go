@@ -1,22 +1,27 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/cheggaaa/pb"
 	"github.com/ernado/selectel/storage"
+	"github.com/ernado/selectel/storage/davfs"
+	"github.com/ernado/selectel/storage/dirsync"
+	"github.com/ernado/selectel/storage/encrypted"
+	"github.com/ernado/selectel/storage/s3gateway"
 	"github.com/jwaldrip/odin/cli"
 	"github.com/olekukonko/tablewriter"
+	"golang.org/x/net/webdav"
 	"io"
-	"io/ioutil"
 	"log"
-	"mime"
+	"math"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -24,9 +29,15 @@ const (
 	envKey        = storage.EnvKey
 	envUser       = storage.EnvUser
 	version       = "1.1"
-	cacheFilename = "~selct.cache~" + version
+	cacheFilename = "token"
 	envCache      = "SELECTEL_CACHE"
 	envContainer  = "SELECTEL_CONTAINER"
+	envAuthURL    = storage.EnvAuthURL
+	envAuthMode   = storage.EnvAuthMode
+	envS3Access   = "SELECTEL_S3_ACCESS_KEY"
+	envS3Secret   = "SELECTEL_S3_SECRET_KEY"
+	envEncryptKey = "SELECTEL_ENCRYPT_KEY"
+	envWebDAVAuth = "SELECTEL_WEBDAV_AUTH"
 )
 
 var (
@@ -37,7 +48,15 @@ var (
 	debug          bool
 	cache          bool
 	cacheSecure    bool
+	tempAuth       bool
+	trace          bool
+	traceBody      int
+	encryptKey     []byte
 	errorNotEnough = errors.New("Not enought arguments")
+	errorBadRate   = errors.New("Bad rate, expected bytes per second with optional K, M or G suffix")
+	errorBadTypes  = errors.New("Bad types, expected comma separated ext=type pairs")
+	errorEncrypt   = errors.New("Encryption is not supported by sync and s3-gateway, unset --encrypt-key")
+	errorBadAuth   = errors.New("Bad webdav auth, expected user:password")
 )
 
 func encryptionKey() []byte {
@@ -48,42 +67,12 @@ func encryptionKey() []byte {
 	return hasher.Sum(nil)
 }
 
-func encrypt(data []byte) []byte {
-	block, err := aes.NewCipher(encryptionKey())
-	if err != nil {
-		panic(err)
-	}
-
-	ciphertext := make([]byte, aes.BlockSize+len(data))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		panic(err)
-	}
-
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], data)
-	return ciphertext
-}
-
-func decrypt(data []byte) ([]byte, error) {
-	block, err := aes.NewCipher(encryptionKey())
-	if err != nil {
-		return nil, err
-	}
-
-	if len(data) < aes.BlockSize {
-		return nil, errors.New("ciphertext too short")
-	}
-	iv := data[:aes.BlockSize]
-	data = data[aes.BlockSize:]
-	stream := cipher.NewCFBDecrypter(block, iv)
-	stream.XORKeyStream(data, data)
-
-	return data, nil
-}
-
 func init() {
 	client.DefineBoolFlagVar(&debug, "debug", false, "debug mode")
+	client.DefineBoolFlagVar(&trace, "trace", false, "dump requests and responses to stderr as curl commands")
+	client.DefineIntFlagVar(&traceBody, "trace.body", 0, "dump bodies up to n bytes in trace mode")
+	client.DefineStringFlag("encrypt-key", "", fmt.Sprintf("hex master key of 16, 24 or 32 bytes to encrypt uploads and decrypt downloads (%s)", envEncryptKey))
+	client.DefineStringFlag("limit-rate", "", "limit transfer rate in bytes per second, e.g. 10M")
 	client.DefineBoolFlagVar(&cache, "cache", false, fmt.Sprintf("cache token in file (%s)", envCache))
 	client.DefineBoolFlagVar(&cacheSecure, "cache.secure", true, "encrypt/decrypt token with user-key pair (true by default)")
 	client.DefineStringFlag("key", "", fmt.Sprintf("selectel storage key (%s)", envKey))
@@ -92,6 +81,8 @@ func init() {
 	client.AliasFlag('u', "user")
 	client.DefineStringFlag("container", "", fmt.Sprintf("default container (%s)", envContainer))
 	client.AliasFlag('c', "container")
+	client.DefineStringFlag("auth-url", "", fmt.Sprintf("auth endpoint url (%s)", envAuthURL))
+	client.DefineBoolFlagVar(&tempAuth, "tempauth", false, fmt.Sprintf("use openstack swift tempauth (%s=%s)", envAuthMode, storage.AuthModeTempAuth))
 
 	infoCommand := client.DefineSubCommand("info", "print information about storage/container/object", wrap(info))
 	infoCommand.DefineStringFlag("type", "storage", "storage, container or object")
@@ -101,13 +92,43 @@ func init() {
 	listCommand.DefineStringFlag("type", "storage", "storage or container")
 	listCommand.AliasFlag('t', "type")
 
-	client.DefineSubCommand("upload", "upload object to container", wrap(upload))
+	uploadCommand := client.DefineSubCommand("upload", "upload object or directory recursively to container", wrap(upload))
+	uploadCommand.DefineIntFlag("workers", 4, "count of parallel uploads of directory")
+	uploadCommand.AliasFlag('j', "workers")
+	uploadCommand.DefineIntFlag("retries", 2, "count of retries of failed upload of file in directory")
+	uploadCommand.DefineStringFlag("prefix", "", "prefix of object names of directory, e.g. build/")
+	uploadCommand.DefineStringFlag("compress", "", "compress uploads with gzip or zstd")
+	uploadCommand.DefineStringFlag("types", "", "content types of extensions, e.g. md=text/markdown,wasm=application/wasm")
 	downloadCommand := client.DefineSubCommand("download", "download object from container", wrap(download))
 	downloadCommand.DefineStringFlag("path", "", "destination path")
 	downloadCommand.AliasFlag('p', "path")
 
 	client.DefineSubCommand("create", "create container", wrap(create))
 
+	webdavCommand := client.DefineSubCommand("webdav", "serve container over webdav", wrap(serveWebDAV))
+	webdavCommand.DefineStringFlag("listen", "127.0.0.1:8080", "address to listen")
+	webdavCommand.AliasFlag('l', "listen")
+	webdavCommand.DefineStringFlag("auth", "", fmt.Sprintf("require basic auth with user:password (%s)", envWebDAVAuth))
+
+	syncCommand := client.DefineSubCommand("sync", "sync directory with container[/prefix]", wrap(syncDir))
+	syncCommand.DefineStringFlag("direction", "up", "up, down or mirror")
+	syncCommand.AliasFlag('d', "direction")
+	syncCommand.DefineBoolFlag("delete", false, "remove files or objects, that are missing on source side")
+	syncCommand.DefineStringFlag("include", "", "sync only names matching comma separated globs")
+	syncCommand.DefineStringFlag("exclude", "", "skip names matching comma separated globs")
+	syncCommand.DefineBoolFlag("dry-run", false, "print actions without executing them")
+	syncCommand.AliasFlag('n', "dry-run")
+	syncCommand.DefineIntFlag("concurrency", 4, "count of parallel transfers")
+	syncCommand.AliasFlag('j', "concurrency")
+	syncCommand.DefineStringFlag("types", "", "content types of extensions, e.g. md=text/markdown,wasm=application/wasm")
+
+	gatewayCommand := client.DefineSubCommand("s3-gateway", "serve storage over s3 api", wrap(serveS3))
+	gatewayCommand.DefineStringFlag("listen", "127.0.0.1:9000", "address to listen")
+	gatewayCommand.AliasFlag('l', "listen")
+	gatewayCommand.DefineStringFlag("access-key", "", fmt.Sprintf("s3 access key (%s)", envS3Access))
+	gatewayCommand.DefineStringFlag("secret-key", "", fmt.Sprintf("s3 secret key (%s)", envS3Secret))
+	gatewayCommand.DefineStringFlag("region", s3gateway.DefaultRegion, "s3 region of signatures")
+
 	removeCommand := client.DefineSubCommand("remove", "remove object or container", wrap(remove))
 	removeCommand.DefineStringFlag("type", "object", "container or object")
 	removeCommand.DefineBoolFlag("force", false, "remove container with files")
@@ -126,19 +147,66 @@ func blank(s string) bool {
 	return len(s) == 0
 }
 
-func load() ([]byte, error) {
-	f, err := os.Open(cacheFilename)
+// cachePath returns path of token cache file in user cache directory
+func cachePath() string {
+	dir, err := os.UserCacheDir()
 	if err != nil {
-		return nil, err
+		dir = os.TempDir()
 	}
-	data, err := ioutil.ReadAll(f)
-	if err != nil {
-		return nil, err
+	return filepath.Join(dir, "selctl", cacheFilename)
+}
+
+// tokenStore returns file token store, that is encrypted with user-key pair
+// in secure mode
+func tokenStore() *storage.FileTokenStore {
+	store := storage.NewFileTokenStore(cachePath())
+	if cacheSecure {
+		store.Key = encryptionKey()
+	}
+	return store
+}
+
+// parseRate parses bytes per second with optional binary suffix, e.g. 10M
+func parseRate(s string) (int64, error) {
+	var multiplier int64 = 1
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	rate, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || rate <= 0 || rate > math.MaxInt64/multiplier {
+		return 0, errorBadRate
+	}
+	return rate * multiplier, nil
+}
+
+// options returns client options from flags and environment
+func options(c cli.Command) []storage.Option {
+	opts := []storage.Option{storage.WithUserAgent("selctl/" + version)}
+	if url := readFlag(c, "auth-url", envAuthURL); !blank(url) {
+		opts = append(opts, storage.WithAuthURL(url))
+	}
+	if tempAuth || strings.ToLower(os.Getenv(envAuthMode)) == storage.AuthModeTempAuth {
+		opts = append(opts, storage.WithTempAuth())
+	}
+	if trace {
+		opts = append(opts, storage.WithDump(os.Stderr, int64(traceBody)))
 	}
-	if !cacheSecure {
-		return data, nil
+	if rate := c.Flag("limit-rate").String(); !blank(rate) {
+		limit, err := parseRate(rate)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, storage.WithRateLimit(limit))
 	}
-	return decrypt(data)
+	return opts
 }
 
 // connect reads credentials and performs auth
@@ -148,55 +216,62 @@ func connect(c cli.Command) {
 	key = readFlag(c, "key", envKey)
 	user = readFlag(c, "user", envUser)
 	container = readFlag(c, "container", envContainer)
+	if hexKey := readFlag(c, "encrypt-key", envEncryptKey); !blank(hexKey) {
+		if encryptKey, err = hex.DecodeString(hexKey); err != nil {
+			log.Fatal(encrypted.ErrorBadKey)
+		}
+	}
+	opts := options(c)
 
 	if strings.ToLower(os.Getenv(envCache)) == "true" {
 		cache = true
 	}
 
-	if cache {
-		var data []byte
-		data, err = load()
-		if err != nil {
-			log.Println(err)
-		} else {
-			api, err = storage.NewFromCache(data)
+	if !cache {
+		os.Remove(cachePath())
+	} else {
+		store := tokenStore()
+		opts = append(opts, storage.WithTokenStore(store))
+		// token can be used without credentials, if it is not encrypted with them
+		if blank(key) || blank(user) {
+			api, err = storage.NewFromStore(store, opts...)
 			if err == nil {
+				api.Debug(debug)
 				return
-			} else {
-				log.Println("unable to load from cache:", err)
 			}
+			log.Println("unable to load from cache:", err)
 		}
-	} else {
-		os.Remove(cacheFilename)
 	}
 
 	// checking for blank credentials
-	if blank(key) || blank(user) && api != nil {
+	if blank(key) || blank(user) {
 		log.Fatal(storage.ErrorBadCredentials)
 	}
 
 	// connencting to api
-	api = storage.NewAsync(user, key)
+	api = storage.NewAsync(user, key, opts...)
 	api.Debug(debug)
 	if err = api.Auth(user, key); err != nil {
 		log.Fatal(err)
 	}
 }
 
+// transferContainer returns container for uploads and downloads, that
+// encrypts and decrypts objects if encryption key is set
+func transferContainer(name string) storage.ContainerAPI {
+	if encryptKey == nil {
+		return api.Container(name)
+	}
+	c, err := encrypted.New(api.Container(name), encryptKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+
 func wrap(callback func(cli.Command)) func(cli.Command) {
 	return func(c cli.Command) {
 		connect(c.Parent())
-		defer func() {
-			if !cache {
-				return
-			}
-			data, _ := api.Dump()
-			if cacheSecure {
-				data = encrypt(data)
-			}
-			f, _ := os.Create(cacheFilename)
-			f.Write(data)
-		}()
 		callback(c)
 	}
 }
@@ -321,6 +396,31 @@ func create(c cli.Command) {
 	fmt.Printf("created container %s\n", name)
 }
 
+// progressBar returns transfer option, that shows bar for each phase
+// of transfer, and function, that finishes last bar
+func progressBar() (storage.TransferOption, func()) {
+	var (
+		bar   *pb.ProgressBar
+		phase string
+	)
+	finish := func() {
+		if bar != nil {
+			bar.Finish()
+			bar = nil
+		}
+	}
+	option := storage.OnProgress(func(p storage.Progress) {
+		if p.Phase != phase || bar == nil {
+			finish()
+			phase = p.Phase
+			bar = pb.New64(p.Total).SetUnits(pb.U_BYTES).Prefix(phase + " ")
+			bar.Start()
+		}
+		bar.Set64(p.Done)
+	})
+	return option, finish
+}
+
 func upload(c cli.Command) {
 	var path string
 	switch len(c.Args()) {
@@ -343,17 +443,67 @@ func upload(c cli.Command) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	ext := filepath.Ext(path)
-	mimetype := mime.TypeByExtension(ext)
-	bar := pb.New64(stat.Size()).SetUnits(pb.U_BYTES)
-	bar.Start()
-	reader := io.TeeReader(f, bar)
-	if err := api.Container(container).Upload(reader, stat.Name(), mimetype); err != nil {
+	if stat.IsDir() {
+		f.Close()
+		uploadDir(c, path)
+		return
+	}
+	progress, finish := progressBar()
+	err = transferContainer(container).Upload(f, stat.Name(), "", append(uploadOptions(c), progress)...)
+	finish()
+	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Printf("uploaded to %s\n", container)
 }
 
+// uploadOptions returns transfer options of --compress and --types flags
+func uploadOptions(c cli.Command) []storage.TransferOption {
+	opts := contentTypes(c)
+	if encoding := c.Flag("compress").String(); !blank(encoding) {
+		opts = append(opts, storage.Compress(encoding))
+	}
+	return opts
+}
+
+// contentTypes returns option with content types of --types flag
+func contentTypes(c cli.Command) []storage.TransferOption {
+	pairs := globs(c.Flag("types").String())
+	if len(pairs) == 0 {
+		return nil
+	}
+	types := make(map[string]string)
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || blank(parts[0]) || blank(parts[1]) {
+			log.Fatal(errorBadTypes)
+		}
+		types[parts[0]] = parts[1]
+	}
+	return []storage.TransferOption{storage.ContentTypes(types)}
+}
+
+// uploadDir uploads directory recursively and prints failed files and summary
+func uploadDir(c cli.Command, path string) {
+	summary, err := storage.UploadDir(transferContainer(container), path,
+		storage.Workers(c.Flag("workers").Get().(int)),
+		storage.Retries(c.Flag("retries").Get().(int)),
+		storage.DirPrefix(c.Flag("prefix").String()),
+		storage.FileOptions(uploadOptions(c)...),
+		storage.OnFile(func(file storage.FileResult) {
+			if file.Err != nil {
+				fmt.Printf("failed %s after %d attempts: %s\n", file.Name, file.Attempts, file.Err)
+				return
+			}
+			fmt.Printf("uploaded %s\n", file.Name)
+		}),
+	)
+	fmt.Printf("%s to %s\n", summary, container)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
 func list(c cli.Command) {
 	var (
 		arglen = len(c.Args())
@@ -409,7 +559,8 @@ func download(c cli.Command) {
 	if blank(path) {
 		path = objectName
 	}
-	reader, err := api.Container(container).Object(objectName).GetReader()
+	progress, finish := progressBar()
+	reader, err := transferContainer(container).Object(objectName).GetReader(progress)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -420,12 +571,136 @@ func download(c cli.Command) {
 		log.Fatal(err)
 	}
 	n, err := io.Copy(f, reader)
+	finish()
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Printf("downloaded %s, %d bytes\n", objectName, n)
 }
 
+func serveWebDAV(c cli.Command) {
+	if len(c.Args()) > 0 {
+		container = c.Arg(0).String()
+	}
+	if blank(container) {
+		log.Fatal(errorNotEnough)
+	}
+	listen := c.Flag("listen").String()
+	var handler http.Handler = &webdav.Handler{
+		FileSystem: davfs.New(transferContainer(container)),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				log.Println(r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	if auth := readFlag(c, "auth", envWebDAVAuth); !blank(auth) {
+		user, password, ok := strings.Cut(auth, ":")
+		if !ok || blank(user) {
+			log.Fatal(errorBadAuth)
+		}
+		handler = basicAuth(handler, user, password)
+	}
+	fmt.Printf("serving %s over webdav on %s\n", container, listen)
+	log.Fatal(http.ListenAndServe(listen, handler))
+}
+
+// basicAuth passes requests with user and password to handler
+func basicAuth(handler http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="selctl"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// globs returns comma separated patterns
+func globs(s string) []string {
+	var patterns []string
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); !blank(pattern) {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+func syncDir(c cli.Command) {
+	if len(c.Args()) != 2 {
+		log.Fatal(errorNotEnough)
+	}
+	// hashes and sizes of encrypted objects differ from files
+	if encryptKey != nil {
+		log.Fatal(errorEncrypt)
+	}
+	dir := c.Arg(0).String()
+	target := strings.SplitN(c.Arg(1).String(), "/", 2)
+	prefix := ""
+	if len(target) == 2 {
+		prefix = target[1]
+	}
+	direction, err := dirsync.ParseDirection(c.Flag("direction").String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	dryRun := c.Flag("dry-run").Get().(bool)
+	syncer := dirsync.New(dir, api.Container(target[0]),
+		dirsync.WithDirection(direction),
+		dirsync.WithPrefix(prefix),
+		dirsync.WithDelete(c.Flag("delete").Get().(bool)),
+		dirsync.WithInclude(globs(c.Flag("include").String())...),
+		dirsync.WithExclude(globs(c.Flag("exclude").String())...),
+		dirsync.WithDryRun(dryRun),
+		dirsync.WithConcurrency(c.Flag("concurrency").Get().(int)),
+		dirsync.WithUploadOptions(contentTypes(c)...),
+		dirsync.WithReport(func(action dirsync.Action) {
+			switch {
+			case dryRun:
+				fmt.Printf("(dry run) %s\n", action)
+			case action.Err != nil:
+				fmt.Printf("failed %s: %s\n", action, action.Err)
+			default:
+				fmt.Println(action)
+			}
+		}),
+	)
+	actions, err := syncer.Run()
+	failed := 0
+	for _, action := range actions {
+		if action.Err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("%d actions, %d failed\n", len(actions), failed)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serveS3(c cli.Command) {
+	if encryptKey != nil {
+		log.Fatal(errorEncrypt)
+	}
+	accessKey := readFlag(c, "access-key", envS3Access)
+	secretKey := readFlag(c, "secret-key", envS3Secret)
+	if blank(accessKey) || blank(secretKey) {
+		log.Fatal(errorNotEnough)
+	}
+	listen := c.Flag("listen").String()
+	gateway := s3gateway.New(api,
+		s3gateway.WithCredentials(accessKey, secretKey),
+		s3gateway.WithRegion(c.Flag("region").String()),
+	)
+	fmt.Printf("serving storage over s3 api on %s\n", listen)
+	log.Fatal(http.ListenAndServe(listen, gateway))
+}
+
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -2,17 +2,20 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,6 +29,7 @@ const (
 	putMethod              = "PUT"
 	deleteMethod           = "DELETE"
 	authTokenHeader        = "X-Auth-Token"
+	userAgentHeader        = "User-Agent"
 	objectCountHeader      = "X-Account-Object-Count"
 	bytesUsedHeader        = "X-Account-Bytes-Used"
 	containerCountHeader   = "X-Account-Container-Count"
@@ -48,60 +52,138 @@ var (
 	ErrorBadName = errors.New("Bad container/object name provided")
 	// ErrorBadJSON occurs on unmarhalling error
 	ErrorBadJSON = errors.New("Unable to parse api responce")
+	// ErrorBodyNotRewindable occurs when request can not be replayed,
+	// because its body has no GetBody
+	ErrorBodyNotRewindable = errors.New("Request body can not be rewound")
 )
 
 // Client is selectel storage api client
 type Client struct {
-	storageURL  *url.URL
-	token       string
-	tokenExpire int
-	expireFrom  *time.Time
-	user        string
-	key         string
-	client      DoClient
-	file        fileMock
-	debug       bool
+	// mu guards token and storage url, that can be updated by renewer
+	mu            sync.Mutex
+	storageURL    *url.URL
+	token         string
+	tokenExpire   int
+	expireFrom    *time.Time
+	flight        *authFlight
+	user          string
+	key           string
+	authURL       string
+	tempAuth      bool
+	authenticator Authenticator
+	store         TokenStore
+	provider      CredentialsProvider
+	rejected      string
+	client        DoClient
+	interceptors  []Interceptor
+	chain         DoClient
+	authChain     DoClient
+	timeout       time.Duration
+	transport     http.RoundTripper
+	userAgent     string
+	logger        Logger
+	tracer        Tracer
+	dump          *dumper
+	rate          int64
+	limiter       *limiter
+	file          fileMock
+	level         slog.Level
+	debugging     atomic.Bool
+	clock         Clock
+	renewal       renewal
 }
 
+// ClientCredentials is auth token with storage url, that can be
+// reused by other clients
 type ClientCredentials struct {
 	Token      string
 	Debug      bool
 	Expire     int
 	ExpireFrom *time.Time
 	URL        string
+	User       string
 }
 
-func NewFromCache(data []byte) (API, error) {
-	var (
-		cache = new(ClientCredentials)
-		err   error
-	)
+// Expired returns true if token is expired or does not exist
+func (cache ClientCredentials) Expired() bool {
+	return cache.expired(SystemClock.Now())
+}
+
+func (cache ClientCredentials) expired(now time.Time) bool {
+	return expired(cache.Token, cache.ExpireFrom, cache.Expire, now)
+}
+
+// NewFromCache returns client with credentials from data, returned by Client.Dump.
+//
+// Deprecated: use WithTokenStore option, that loads and saves token automatically.
+func NewFromCache(data []byte, opts ...Option) (API, error) {
+	cache := new(ClientCredentials)
 	decorer := gob.NewDecoder(bytes.NewBuffer(data))
-	if err = decorer.Decode(cache); err != nil {
+	if err := decorer.Decode(cache); err != nil {
 		return nil, err
 	}
-	c := newClient(new(http.Client))
+	c := newClient(opts...)
+	if err := c.setCredentials(*cache); err != nil {
+		return nil, err
+	}
+	c.Debug(cache.Debug)
+	return c, nil
+}
+
+// NewFromStore returns client with credentials loaded from token store,
+// that is also used to save token after authentication
+func NewFromStore(store TokenStore, opts ...Option) (API, error) {
+	cache, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	c := newClient(append(opts, WithTokenStore(store))...)
+	if err := c.setCredentials(cache); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setCredentials sets token and storage url from cache
+func (c *Client) setCredentials(cache ClientCredentials) error {
+	storageURL, err := url.Parse(cache.URL)
+	if err != nil {
+		return ErrorBadCredentials
+	}
+	c.storageURL = storageURL
 	c.token = cache.Token
 	c.tokenExpire = cache.Expire
-	c.debug = cache.Debug
 	c.expireFrom = cache.ExpireFrom
-	c.storageURL, err = url.Parse(cache.URL)
-	if err != nil {
-		return nil, ErrorBadCredentials
+	if !blank(cache.User) {
+		c.user = cache.User
 	}
-	return c, nil
+	return nil
 }
 
+// Credentials returns current token and storage url
 func (c *Client) Credentials() (cache ClientCredentials) {
-	cache.URL = c.storageURL.String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cache()
+}
+
+// cache is Credentials, that requires c.mu to be held
+func (c *Client) cache() (cache ClientCredentials) {
+	if c.storageURL != nil {
+		cache.URL = c.storageURL.String()
+	}
 	cache.Expire = c.tokenExpire
 	cache.ExpireFrom = c.expireFrom
 	cache.Token = c.token
-	cache.Debug = c.debug
+	cache.Debug = c.debug()
+	cache.User = c.user
 
 	return cache
 }
 
+// Dump returns gob-encoded Credentials.
+//
+// Deprecated: use WithTokenStore option, that loads and saves token automatically.
 func (c *Client) Dump() ([]byte, error) {
 	buffer := new(bytes.Buffer)
 	encoder := gob.NewEncoder(buffer)
@@ -124,8 +206,8 @@ type StorageInformation struct {
 type API interface {
 	DoClient
 	Info() StorageInformation
-	Upload(reader io.Reader, container, filename, t string) error
-	UploadFile(filename, container string) error
+	Upload(reader io.Reader, container, filename, t string, opts ...TransferOption) error
+	UploadFile(filename, container string, opts ...TransferOption) error
 	Auth(user, key string) error
 	Debug(debug bool)
 	Token() string
@@ -137,7 +219,7 @@ type API interface {
 	RemoveContainer(name string) error
 	// ObjectInfo returns information about object in container
 	ObjectInfo(container, filename string) (f ObjectInfo, err error)
-	ObjectsInfo(container string) ([]ObjectInfo, error)
+	ObjectsInfo(container string, opts ...ListOption) ([]ObjectInfo, error)
 	ContainerInfo(name string) (info ContainerInfo, err error)
 	ContainersInfo() ([]ContainerInfo, error)
 	Containers() ([]ContainerAPI, error)
@@ -150,19 +232,25 @@ type DoClient interface {
 	Do(request *http.Request) (*http.Response, error)
 }
 
+// DoFunc is function adapter for DoClient
+type DoFunc func(request *http.Request) (*http.Response, error)
+
+// Do calls f(request)
+func (f DoFunc) Do(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
 // setClient sets client
 func (c *Client) setClient(client DoClient) {
 	c.client = client
 }
 
-func (c *Client) Debug(debug bool) {
-	c.debug = debug
-}
-
 // ContainersInfo return all container-specific information from storage
-func (c *Client) ContainersInfo() ([]ContainerInfo, error) {
-	info := []ContainerInfo{}
-	request, err := c.NewRequest(getMethod, nil)
+func (c *Client) ContainersInfo() (info []ContainerInfo, err error) {
+	ctx, span := c.startSpan(context.Background(), "ContainersInfo", "", "")
+	defer endSpan(span, &err)
+	info = []ContainerInfo{}
+	request, err := c.newRequest(ctx, getMethod, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -197,15 +285,19 @@ func (c *Client) Containers() ([]ContainerAPI, error) {
 	return containers, nil
 }
 
-// ObjectsInfo returns information about all objects in container
-func (c *Client) ObjectsInfo(container string) ([]ObjectInfo, error) {
-	info := []ObjectInfo{}
-	request, err := c.NewRequest(getMethod, nil, container)
+// ObjectsInfo returns information about all objects in container,
+// that match options
+func (c *Client) ObjectsInfo(container string, opts ...ListOption) (info []ObjectInfo, err error) {
+	ctx, span := c.startSpan(context.Background(), "ObjectsInfo", container, "")
+	defer endSpan(span, &err)
+	info = []ObjectInfo{}
+	request, err := c.newRequest(ctx, getMethod, nil, container)
 	if err != nil {
 		return nil, err
 	}
 	query := request.URL.Query()
 	query.Add(queryFormat, queryJSON)
+	NewListOptions(opts...).apply(query)
 	request.URL.RawQuery = query.Encode()
 	res, err := c.Do(request)
 	if err != nil {
@@ -222,18 +314,25 @@ func (c *Client) ObjectsInfo(container string) ([]ObjectInfo, error) {
 	if err := decoder.Decode(&info); err != nil {
 		return nil, ErrorBadJSON
 	}
+	location := c.clock.Now().Location()
 	for i, v := range info {
+		if !blank(v.Subdir) {
+			continue
+		}
 		info[i].LastModified, err = time.Parse(fileLastModifiedLayout, v.LastModifiedStr)
 		if err != nil {
 			return info, err
 		}
+		info[i].LastModified = info[i].LastModified.In(location)
 	}
 	return info, nil
 }
 
 // DeleteObject removes object from specified container
-func (c *Client) RemoveObject(container, filename string) error {
-	request, err := c.NewRequest(deleteMethod, nil, container, filename)
+func (c *Client) RemoveObject(container, filename string) (err error) {
+	ctx, span := c.startSpan(context.Background(), "RemoveObject", container, filename)
+	defer endSpan(span, &err)
+	request, err := c.newRequest(ctx, deleteMethod, nil, container, filename)
 	if err != nil {
 		return err
 	}
@@ -252,7 +351,10 @@ func (c *Client) RemoveObject(container, filename string) error {
 
 // Info returns StorageInformation for current user
 func (c *Client) Info() (info StorageInformation) {
-	request, err := c.NewRequest(getMethod, nil)
+	var err error
+	ctx, span := c.startSpan(context.Background(), "Info", "", "")
+	defer endSpan(span, &err)
+	request, err := c.newRequest(ctx, getMethod, nil)
 	if err != nil {
 		return
 	}
@@ -282,52 +384,66 @@ func (c *Client) Do(request *http.Request) (res *http.Response, err error) {
 	return c.do(request)
 }
 
+// do performs request through interceptor chain
 func (c *Client) do(request *http.Request) (res *http.Response, err error) {
 	// prevent null pointer dereference
 	if request.Header == nil {
 		request.Header = http.Header{}
 	}
+	return c.chain.Do(request)
+}
+
+// rewind replaces consumed request body with new one from GetBody
+func rewind(request *http.Request) error {
+	if request.Body == nil || request.Body == http.NoBody {
+		return nil
+	}
+	if request.GetBody == nil {
+		return ErrorBodyNotRewindable
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return err
+	}
+	request.Body = body
+	return nil
+}
+
+// authorize returns current token, performing auth if token is expired
+func (c *Client) authorize(request *http.Request) (string, error) {
+	c.mu.Lock()
 	// check for token expiration / first request with async auth
-	if request.URL.String() != authURL && c.Expired() {
-		log.Println("[selectel]", "token expired, performing auth")
-		if err = c.Auth(c.user, c.key); err != nil {
-			return
-		}
-		// fix hostname of request
-		c.fixURL(request)
-	}
-	// add auth token to headers
-	if !blank(c.token) {
-		request.Header.Add(authTokenHeader, c.token)
-	}
-	if c.debug {
-		// perform request and record time elapsed
-		start := time.Now().Truncate(time.Millisecond)
-		res, err = c.client.Do(request)
-		stop := time.Now().Truncate(time.Millisecond)
-		duration := stop.Sub(start)
-		// log error
-		if err != nil {
-			log.Println(request.Method, request.URL.String(), err, duration)
-			return
-		}
-		// log request
-		log.Println(request.Method, request.URL.String(), res.StatusCode, duration)
-		// check for auth code
-	} else {
-		res, err = c.client.Do(request)
-		if err != nil {
-			return
-		}
+	if !expired(c.token, c.expireFrom, c.tokenExpire, c.clock.Now()) {
+		defer c.mu.Unlock()
+		return c.token, nil
 	}
-	if res.StatusCode == http.StatusUnauthorized {
-		c.expireFrom = nil // ensure that next request will force authentication
-		return nil, ErrorAuth
+	c.log(request.Context(), LevelInfo, "token expired, performing auth")
+	user, key, err := c.credentials()
+	previous := c.join()
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
 	}
-	return
+	if err = c.auth(request.Context(), user, key); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// fix hostname of request
+	if err = c.fixURL(request, previous); err != nil {
+		return "", err
+	}
+	return c.token, nil
 }
 
+// NewRequest returns request to account, container or object, that is
+// identified by parms
 func (c *Client) NewRequest(method string, body io.Reader, parms ...string) (*http.Request, error) {
+	return c.newRequest(context.Background(), method, body, parms...)
+}
+
+// newRequest is NewRequest with context, e.g. with span of api method
+func (c *Client) newRequest(ctx context.Context, method string, body io.Reader, parms ...string) (*http.Request, error) {
 	var badName bool
 	for i := range parms {
 		// check for length
@@ -337,20 +453,43 @@ func (c *Client) NewRequest(method string, body io.Reader, parms ...string) (*ht
 		// todo: check for trialing slash
 		parms[i] = url.QueryEscape(parms[i])
 	}
-	req, err := http.NewRequest(method, c.url(parms...), body)
+	req, err := http.NewRequestWithContext(ctx, method, c.url(parms...), body)
 	if err != nil || badName {
 		return nil, ErrorBadName
 	}
-	return req, nil
+	return withOperation(req, operation(method, len(parms))), nil
 }
 
-func (c *Client) fixURL(request *http.Request) error {
-	newRequest, err := http.NewRequest(request.Method, c.url(request.URL.Path), request.Body)
-	*request = *newRequest
-	return err
+// fixURL moves request from previous storage url to current one, e.g.
+// after first auth of async client, keeping headers and body of request.
+// c.mu must be held.
+func (c *Client) fixURL(request *http.Request, previous string) error {
+	target := request.URL.String()
+	switch {
+	case !blank(previous) && strings.HasPrefix(target, previous):
+		target = c.join() + strings.TrimPrefix(target, previous)
+	case !request.URL.IsAbs():
+		target = c.join() + target
+	default:
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	request.URL = u
+	request.Host = u.Host
+	return nil
 }
 
 func (c *Client) url(postfix ...string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.join(postfix...)
+}
+
+// join returns storage url with path, c.mu must be held
+func (c *Client) join(postfix ...string) string {
 	path := strings.Join(postfix, "/")
 	if c.storageURL == nil {
 		return path
@@ -359,14 +498,14 @@ func (c *Client) url(postfix ...string) string {
 }
 
 // New returns new selectel storage api client
-func New(user, key string) (API, error) {
-	client := newClient(new(http.Client))
+func New(user, key string, opts ...Option) (API, error) {
+	client := newClient(opts...)
 	return client, client.Auth(user, key)
 }
 
 // NewAsync returns new api client and lazily performs auth
-func NewAsync(user, key string) API {
-	c := newClient(new(http.Client))
+func NewAsync(user, key string, opts ...Option) API {
+	c := newClient(opts...)
 	if blank(user) || blank(key) {
 		panic(ErrorBadCredentials)
 	}
@@ -375,17 +514,54 @@ func NewAsync(user, key string) API {
 	return c
 }
 
-func newClient(client *http.Client) *Client {
+func newClient(opts ...Option) *Client {
 	c := new(Client)
-	c.client = client
+	c.authURL = defaultAuthURL
+	c.logger = defaultLogger()
+	c.tracer = noopTracer{}
+	c.level = LevelInfo
+	c.clock = SystemClock
+	c.renewal.init()
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.authenticator == nil {
+		c.authenticator = &V1Auth{URL: c.authURL, TempAuth: c.tempAuth}
+	}
+	if c.rate > 0 {
+		c.limiter = newLimiter(c.rate, c.clock)
+	}
+	c.client = c.httpClient()
+	c.buildChain()
 	return c
 }
 
-// NewEnv acts as New, but reads credentials from environment
-func NewEnv() (API, error) {
+// httpClient returns client with timeout and transport from options
+func (c *Client) httpClient() DoClient {
+	if c.client == nil {
+		return &http.Client{Timeout: c.timeout, Transport: c.transport}
+	}
+	client, ok := c.client.(*http.Client)
+	if !ok || (c.timeout == 0 && c.transport == nil) {
+		return c.client
+	}
+	// copy to prevent modification of provided client
+	configured := *client
+	if c.timeout != 0 {
+		configured.Timeout = c.timeout
+	}
+	if c.transport != nil {
+		configured.Transport = c.transport
+	}
+	return &configured
+}
+
+// NewEnv acts as New, but reads credentials and auth endpoint from environment.
+// Options override values from environment.
+func NewEnv(opts ...Option) (API, error) {
 	user := os.Getenv(EnvUser)
 	key := os.Getenv(EnvKey)
-	return New(user, key)
+	return New(user, key, append(envOptions(), opts...)...)
 }
 
 func blank(s string) bool {
@@ -5,11 +5,12 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"testing"
 )
 
 func TestMethods(t *testing.T) {
-	c := newClient(nil)
+	c := newClient()
 	Convey("Methods", t, func() {
 		resp := new(http.Response)
 		resp.Header = http.Header{}
@@ -105,6 +106,53 @@ func TestMethods(t *testing.T) {
 					So(info[1].LastModified.Second(), ShouldEqual, 49)
 					So(info[1].LastModified.Nanosecond(), ShouldEqual, 7590000)
 				})
+				Convey("Delimiter", func() {
+					callback := func(req *http.Request) (*http.Response, error) {
+						resp := new(http.Response)
+						resp.StatusCode = http.StatusOK
+						So(req.URL.String(), ShouldEqual, "https://xxx.selcdn.ru/container?delimiter=%2F&format=json&prefix=photos%2F")
+						resp.Body = ioutil.NopCloser(bytes.NewBufferString(`[
+							{"subdir": "photos/2013/"},
+							{"bytes": 10, "content_type": "image/png", "hash": "hash",
+							 "last_modified": "2013-05-27T13:16:49.007590", "name": "photos/a.png"}
+						]`))
+						return resp, nil
+					}
+					c.setClient(NewTestClient(callback))
+					info, err := c.Container("container").ObjectsInfo(Prefix("photos/"), Delimiter("/"))
+					So(err, ShouldBeNil)
+					So(info, ShouldHaveLength, 2)
+					So(info[0].Subdir, ShouldEqual, "photos/2013/")
+					So(info[0].Name, ShouldEqual, "")
+					So(info[1].Name, ShouldEqual, "photos/a.png")
+					So(info[1].LastModified.Year(), ShouldEqual, 2013)
+				})
+				Convey("Pages", func() {
+					pages := map[string]string{
+						"":   `[{"subdir": "a/"}, {"subdir": "b/"}]`,
+						"b/": `[{"subdir": "b/"}, {"subdir": "c/"}]`,
+						"c/": `[{"subdir": "d/"}]`,
+					}
+					var queries []string
+					callback := func(req *http.Request) (*http.Response, error) {
+						resp := new(http.Response)
+						resp.StatusCode = http.StatusOK
+						queries = append(queries, req.URL.RawQuery)
+						So(req.URL.Query().Get("limit"), ShouldEqual, "2")
+						resp.Body = ioutil.NopCloser(bytes.NewBufferString(pages[req.URL.Query().Get("marker")]))
+						return resp, nil
+					}
+					c.setClient(NewTestClient(callback))
+					info, err := AllObjectsInfo(c.Container("container"), Delimiter("/"), Limit(2))
+					So(err, ShouldBeNil)
+					So(info, ShouldHaveLength, 4)
+					So(info[3].Subdir, ShouldEqual, "d/")
+					So(queries, ShouldHaveLength, 3)
+					So(queries[1], ShouldEqual, "delimiter=%2F&format=json&limit=2&marker=b%2F")
+					pages["c/"] = `[{"subdir": "c/"}, {"subdir": "c/"}]`
+					_, err = AllObjectsInfo(c.Container("container"), Delimiter("/"), Limit(2))
+					So(err, ShouldEqual, ErrorIncompleteListing)
+				})
 				Convey("Not found", func() {
 					callback := func(req *http.Request) (*http.Response, error) {
 						resp := new(http.Response)
@@ -388,3 +436,113 @@ func TestMethods(t *testing.T) {
 		})
 	})
 }
+
+func TestReplay(t *testing.T) {
+	Convey("Replay", t, func() {
+		var (
+			auths   int
+			puts    int
+			bodies  []string
+			rejects int
+			last    string
+		)
+		storageURL := "https://xxx.selcdn.ru/"
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				auths++
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token"+strconv.Itoa(auths))
+				resp.Header.Add("X-Storage-Url", storageURL)
+				return resp, nil
+			}
+			if request.Header.Get("X-Auth-Token") != "token1" {
+				So(request.URL.String(), ShouldStartWith, storageURL)
+			}
+			So(request.Host, ShouldEqual, request.URL.Host)
+			if request.Body != nil {
+				data, err := ioutil.ReadAll(request.Body)
+				So(err, ShouldBeNil)
+				bodies = append(bodies, string(data))
+			}
+			if request.Header.Get("X-Auth-Token") == "token1" || rejects > 0 {
+				rejects--
+				resp.StatusCode = http.StatusUnauthorized
+				return resp, nil
+			}
+			if request.Method == putMethod {
+				puts++
+				So(request.Header.Get("Content-Type"), ShouldEqual, "text/plain")
+				So(request.Header.Get("ETag"), ShouldNotEqual, "")
+				So(request.Header["X-Auth-Token"], ShouldHaveLength, 1)
+				resp.StatusCode = http.StatusCreated
+				return resp, nil
+			}
+			last = request.URL.String()
+			resp.StatusCode = http.StatusOK
+			resp.Body = ioutil.NopCloser(bytes.NewBufferString("[]"))
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		Convey("Upload", func() {
+			So(c.Upload(bytes.NewBufferString("data"), "c", "o", "text/plain"), ShouldBeNil)
+			So(auths, ShouldEqual, 2)
+			So(puts, ShouldEqual, 1)
+			So(bodies, ShouldResemble, []string{"data", "data"})
+			So(c.Token(), ShouldEqual, "token2")
+		})
+		Convey("Rejected twice", func() {
+			rejects = 2
+			So(c.RemoveObject("c", "o"), ShouldEqual, ErrorAuth)
+			So(auths, ShouldEqual, 2)
+		})
+		Convey("Not rewindable", func() {
+			request, err := c.NewRequest(putMethod, ioutil.NopCloser(bytes.NewBufferString("data")), "c", "o")
+			So(err, ShouldBeNil)
+			_, err = c.Do(request)
+			So(err, ShouldEqual, ErrorBodyNotRewindable)
+			So(auths, ShouldEqual, 1)
+			So(c.Expired(), ShouldBeTrue)
+		})
+		Convey("Storage url change", func() {
+			request, err := c.NewRequest(getMethod, nil, "c")
+			So(err, ShouldBeNil)
+			request.URL.RawQuery = "format=json"
+			storageURL = "https://yyy.selcdn.ru/"
+			res, err := c.Do(request)
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, http.StatusOK)
+			So(last, ShouldEqual, "https://yyy.selcdn.ru/c?format=json")
+		})
+	})
+	Convey("Lazy auth", t, func() {
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.StatusCode = http.StatusNoContent
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			So(request.URL.String(), ShouldEqual, "https://xxx.selcdn.ru/c?format=json")
+			So(request.Host, ShouldEqual, "xxx.selcdn.ru")
+			So(request.Header.Get("X-Custom"), ShouldEqual, "value")
+			resp.StatusCode = http.StatusOK
+			resp.Body = ioutil.NopCloser(bytes.NewBufferString("[]"))
+			return resp, nil
+		}
+		c := NewAsync("user", "key", WithHTTPClient(NewTestClient(callback)))
+		request, err := c.(*Client).NewRequest(getMethod, nil, "c")
+		So(err, ShouldBeNil)
+		request.URL.RawQuery = "format=json"
+		request.Header.Set("X-Custom", "value")
+		res, err := c.Do(request)
+		So(err, ShouldBeNil)
+		So(res.StatusCode, ShouldEqual, http.StatusOK)
+	})
+}
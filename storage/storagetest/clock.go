@@ -0,0 +1,96 @@
+package storagetest
+
+import (
+	"github.com/ernado/selectel/storage"
+	"sync"
+	"time"
+)
+
+// FakeClock is storage.Clock, that is moved manually by Add or Set,
+// so token expiration and renewal can be tested without sleeps
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock returns clock, that is stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns current time of clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns timer, that fires when clock is moved by d
+func (c *FakeClock) NewTimer(d time.Duration) storage.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Add moves clock forward by d and fires expired timers
+func (c *FakeClock) Add(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves clock to now and fires expired timers
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(now) {
+			timers = append(timers, t)
+			continue
+		}
+		t.c <- now
+	}
+	c.timers = timers
+}
+
+// Timers returns count of active timers, e.g. to wait for renewer to
+// schedule refresh before moving clock
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// remove stops timer, returns false if timer already fired or stopped
+func (c *FakeClock) remove(timer *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, t := range c.timers {
+		if t == timer {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.remove(t)
+}
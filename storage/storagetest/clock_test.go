@@ -0,0 +1,105 @@
+package storagetest
+
+import (
+	"bytes"
+	"github.com/ernado/selectel/storage"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it is true or timeout passes
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
+
+func TestFakeClock(t *testing.T) {
+	Convey("Fake clock", t, func() {
+		now := time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC)
+		clock := NewFakeClock(now)
+		So(clock.Now(), ShouldEqual, now)
+		Convey("Timer", func() {
+			timer := clock.NewTimer(time.Minute)
+			So(clock.Timers(), ShouldEqual, 1)
+			clock.Add(59 * time.Second)
+			select {
+			case <-timer.C():
+				So("fired", ShouldBeEmpty)
+			default:
+			}
+			clock.Add(time.Second)
+			So(<-timer.C(), ShouldEqual, now.Add(time.Minute))
+			So(clock.Timers(), ShouldEqual, 0)
+			So(timer.Stop(), ShouldBeFalse)
+		})
+		Convey("Stop", func() {
+			timer := clock.NewTimer(time.Minute)
+			So(timer.Stop(), ShouldBeTrue)
+			So(clock.Timers(), ShouldEqual, 0)
+			clock.Set(now.Add(time.Hour))
+			So(clock.Now(), ShouldEqual, now.Add(time.Hour))
+			select {
+			case <-timer.C():
+				So("fired", ShouldBeEmpty)
+			default:
+			}
+		})
+		Convey("Expired", func() {
+			timer := clock.NewTimer(0)
+			So(<-timer.C(), ShouldEqual, now)
+		})
+		Convey("Memory", func() {
+			m := NewMemory()
+			m.SetClock(clock)
+			_, err := m.CreateContainer("test", false)
+			So(err, ShouldBeNil)
+			So(m.C("test").Upload(bytes.NewReader([]byte("data")), "o", "text/plain"), ShouldBeNil)
+			info, err := m.ObjectInfo("test", "o")
+			So(err, ShouldBeNil)
+			So(info.LastModified.Equal(now), ShouldBeTrue)
+		})
+		Convey("Renewal", func() {
+			var (
+				mu    sync.Mutex
+				auths int
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				auths++
+				w.Header().Set("X-Auth-Token", "token"+strconv.Itoa(auths))
+				mu.Unlock()
+				w.Header().Set("X-Expire-Auth-Token", "110")
+				w.Header().Set("X-Storage-Url", "http://"+r.Host+"/")
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer server.Close()
+			api, err := storage.New("user", "key",
+				storage.WithAuthURL(server.URL),
+				storage.WithClock(clock),
+				storage.WithRenewal(time.Minute, nil),
+			)
+			So(err, ShouldBeNil)
+			defer api.(io.Closer).Close()
+			So(api.Token(), ShouldEqual, "token1")
+			// wait for renewer to schedule refresh
+			So(waitFor(func() bool { return clock.Timers() > 0 }), ShouldBeTrue)
+			clock.Add(49 * time.Second)
+			So(api.Token(), ShouldEqual, "token1")
+			clock.Add(time.Second)
+			So(waitFor(func() bool { return api.Token() != "token1" }), ShouldBeTrue)
+			So(api.Token(), ShouldEqual, "token2")
+		})
+	})
+}
@@ -0,0 +1,743 @@
+package storagetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/ernado/selectel/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	memoryURL          = "memory://storage/"
+	memoryToken        = "memory"
+	maxNameLength      = 256
+	lastModifiedLayout = "2006-01-02T15:04:05.999999"
+	containerPublic    = "public"
+	containerPrivate   = "private"
+)
+
+// Call is record of single Memory method call
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+type memoryObject struct {
+	data         []byte
+	hash         string
+	contentType  string
+	manifest     string
+	metadata     map[string]string
+	encoding     string
+	lastModified time.Time
+	downloaded   uint64
+}
+
+type memoryContainer struct {
+	objects         map[string]*memoryObject
+	containerType   string
+	recievedBytes   uint64
+	transferedBytes uint64
+}
+
+// Memory is in-memory implementation of storage.API, that keeps
+// objects in maps and records all calls for assertions in tests
+type Memory struct {
+	mu         sync.Mutex
+	containers map[string]*memoryContainer
+	calls      []Call
+	token      string
+	debug      bool
+	clock      storage.Clock
+}
+
+// NewMemory returns new empty authenticated in-memory storage
+func NewMemory() *Memory {
+	m := new(Memory)
+	m.containers = make(map[string]*memoryContainer)
+	m.token = memoryToken
+	m.clock = storage.SystemClock
+	return m
+}
+
+// SetClock sets clock, that is used for modification time of objects
+func (m *Memory) SetClock(clock storage.Clock) {
+	m.mu.Lock()
+	m.clock = clock
+	m.mu.Unlock()
+}
+
+func (m *Memory) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	m.mu.Unlock()
+}
+
+// Calls returns copy of all recorded calls
+func (m *Memory) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	calls := make([]Call, len(m.calls))
+	copy(calls, m.calls)
+	return calls
+}
+
+// CallCount returns count of recorded calls of method
+func (m *Memory) CallCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, call := range m.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// ResetCalls removes all recorded calls
+func (m *Memory) ResetCalls() {
+	m.mu.Lock()
+	m.calls = nil
+	m.mu.Unlock()
+}
+
+func badName(names ...string) bool {
+	for _, name := range names {
+		if len(name) > maxNameLength {
+			return true
+		}
+	}
+	return false
+}
+
+// Info returns StorageInformation for all containers
+func (m *Memory) Info() (info storage.StorageInformation) {
+	m.record("Info")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.containers {
+		info.ContainerCount++
+		info.RecievedBytes += c.recievedBytes
+		info.TransferedBytes += c.transferedBytes
+		for _, o := range c.objects {
+			info.ObjectCount++
+			info.BytesUsed += uint64(len(o.data))
+		}
+	}
+	return info
+}
+
+// Upload reads all data from reader and stores it in container, blank
+// content type is detected, data is compressed if compression is requested,
+// manifest and metadata are kept and other transfer options are ignored
+func (m *Memory) Upload(reader io.Reader, container, filename, contentType string, opts ...storage.TransferOption) error {
+	m.record("Upload", container, filename, contentType)
+	if closer, ok := reader.(io.ReadCloser); ok {
+		defer closer.Close()
+	}
+	if badName(container, filename) {
+		return storage.ErrorBadName
+	}
+	if contentType == "" {
+		var err error
+		if contentType, reader, err = storage.DetectContentType(filename, reader, opts...); err != nil {
+			return err
+		}
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	metadata := storage.RequestedMetadata(opts...)
+	encoding := storage.RequestedEncoding(opts...)
+	if encoding != "" {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[storage.OriginalSizeKey] = strconv.Itoa(len(data))
+		if data, err = compress(data, encoding); err != nil {
+			return err
+		}
+	}
+	hash := md5.Sum(data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.containers[container]
+	if !ok {
+		return storage.ErrorBadResponce
+	}
+	c.objects[filename] = &memoryObject{
+		data:         data,
+		hash:         hex.EncodeToString(hash[:]),
+		contentType:  contentType,
+		manifest:     storage.RequestedManifest(opts...),
+		metadata:     metadata,
+		encoding:     encoding,
+		lastModified: m.clock.Now().UTC(),
+	}
+	c.recievedBytes += uint64(len(data))
+	return nil
+}
+
+// UploadFile stores file in container with its base name
+func (m *Memory) UploadFile(filename, container string, opts ...storage.TransferOption) error {
+	m.record("UploadFile", filename, container)
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	stats, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return m.Upload(f, container, stats.Name(), "", opts...)
+}
+
+// Auth checks credentials for blank values
+func (m *Memory) Auth(user, key string) error {
+	m.record("Auth", user, key)
+	if len(user) == 0 || len(key) == 0 {
+		return storage.ErrorBadCredentials
+	}
+	m.mu.Lock()
+	m.token = memoryToken
+	m.mu.Unlock()
+	return nil
+}
+
+// Debug sets debug flag, that is returned in Credentials
+func (m *Memory) Debug(debug bool) {
+	m.record("Debug", debug)
+	m.mu.Lock()
+	m.debug = debug
+	m.mu.Unlock()
+}
+
+// Token returns constant token
+func (m *Memory) Token() string {
+	m.record("Token")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.token
+}
+
+// C is shortcut to Memory.Container
+func (m *Memory) C(name string) storage.ContainerAPI {
+	return m.Container(name)
+}
+
+// Container returns ContainerAPI for container with provided name
+func (m *Memory) Container(name string) storage.ContainerAPI {
+	m.record("Container", name)
+	return &MemoryContainer{name: name, m: m}
+}
+
+// RemoveObject removes object from container
+func (m *Memory) RemoveObject(container, filename string) error {
+	m.record("RemoveObject", container, filename)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, _, err := m.object(container, filename)
+	if err != nil {
+		return err
+	}
+	delete(c.objects, filename)
+	return nil
+}
+
+// URL returns url of object, that can be requested by Memory.Do
+func (m *Memory) URL(container, filename string) string {
+	return memoryURL + container + "/" + filename
+}
+
+// CreateContainer creates new container or updates type of existing
+func (m *Memory) CreateContainer(name string, private bool) (storage.ContainerAPI, error) {
+	m.record("CreateContainer", name, private)
+	if badName(name) {
+		return nil, storage.ErrorBadName
+	}
+	containerType := containerPublic
+	if private {
+		containerType = containerPrivate
+	}
+	m.mu.Lock()
+	c, ok := m.containers[name]
+	if !ok {
+		c = &memoryContainer{objects: make(map[string]*memoryObject)}
+		m.containers[name] = c
+	}
+	c.containerType = containerType
+	m.mu.Unlock()
+	return &MemoryContainer{name: name, m: m}, nil
+}
+
+// RemoveContainer removes empty container
+func (m *Memory) RemoveContainer(name string) error {
+	m.record("RemoveContainer", name)
+	if badName(name) {
+		return storage.ErrorBadName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.containers[name]
+	if !ok {
+		return storage.ErrorObjectNotFound
+	}
+	if len(c.objects) > 0 {
+		return storage.ErrorConianerNotEmpty
+	}
+	delete(m.containers, name)
+	return nil
+}
+
+func (o *memoryObject) info(name string) storage.ObjectInfo {
+	return storage.ObjectInfo{
+		Size:            uint64(len(o.data)),
+		ContentType:     o.contentType,
+		ContentEncoding: o.encoding,
+		Downloaded:      o.downloaded,
+		Hash:            o.hash,
+		Name:            name,
+	}
+}
+
+// compress returns data compressed with encoding
+func compress(data []byte, encoding string) ([]byte, error) {
+	reader, err := storage.CompressReader(bytes.NewReader(data), encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// decompress returns data decompressed with encoding
+func decompress(data []byte, encoding string) ([]byte, error) {
+	reader, err := storage.DecompressReader(bytes.NewReader(data), encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// content returns data and hash of object, data of manifest is
+// concatenation of its segments and hash is md5 of their hashes,
+// m.mu must be held
+func (m *Memory) content(o *memoryObject) ([]byte, string) {
+	if o.manifest == "" {
+		return o.data, o.hash
+	}
+	parts := strings.SplitN(o.manifest, "/", 2)
+	c, ok := m.containers[parts[0]]
+	if !ok || len(parts) != 2 {
+		return nil, o.hash
+	}
+	var names []string
+	for name, segment := range c.objects {
+		if strings.HasPrefix(name, parts[1]) && segment.manifest == "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var data []byte
+	hasher := md5.New()
+	for _, name := range names {
+		data = append(data, c.objects[name].data...)
+		io.WriteString(hasher, c.objects[name].hash)
+	}
+	return data, hex.EncodeToString(hasher.Sum(nil))
+}
+
+// object returns object from container, m.mu must be held
+func (m *Memory) object(container, filename string) (*memoryContainer, *memoryObject, error) {
+	if badName(container, filename) {
+		return nil, nil, storage.ErrorBadName
+	}
+	c, ok := m.containers[container]
+	if !ok {
+		return nil, nil, storage.ErrorObjectNotFound
+	}
+	o, ok := c.objects[filename]
+	if !ok {
+		return nil, nil, storage.ErrorObjectNotFound
+	}
+	return c, o, nil
+}
+
+// ObjectInfo returns information about object in container
+func (m *Memory) ObjectInfo(container, filename string) (f storage.ObjectInfo, err error) {
+	m.record("ObjectInfo", container, filename)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, o, err := m.object(container, filename)
+	if err != nil {
+		return f, err
+	}
+	f = o.info(filename)
+	data, hash := m.content(o)
+	f.Size, f.Hash = uint64(len(data)), hash
+	f.StoredSize = f.Size
+	f.Manifest = o.manifest
+	for key, value := range o.metadata {
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		f.Metadata[key] = value
+	}
+	if size, err := strconv.ParseUint(f.Metadata[storage.OriginalSizeKey], 10, 64); err == nil && o.encoding != "" {
+		f.Size = size
+	}
+	// HEAD responses have second precision
+	f.LastModified = o.lastModified.Truncate(time.Second)
+	return f, nil
+}
+
+// ObjectsInfo returns information about all objects in container,
+// that match options, sorted by name
+func (m *Memory) ObjectsInfo(container string, opts ...storage.ListOption) ([]storage.ObjectInfo, error) {
+	m.record("ObjectsInfo", container)
+	list := storage.NewListOptions(opts...)
+	if badName(container) {
+		return nil, storage.ErrorBadName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.containers[container]
+	if !ok {
+		return nil, storage.ErrorObjectNotFound
+	}
+	info := []storage.ObjectInfo{}
+	subdirs := make(map[string]bool)
+	for name, o := range c.objects {
+		if !strings.HasPrefix(name, list.Prefix) {
+			continue
+		}
+		if i := strings.Index(name[len(list.Prefix):], list.Delimiter); list.Delimiter != "" && i >= 0 {
+			subdirs[name[:len(list.Prefix)+i+len(list.Delimiter)]] = true
+			continue
+		}
+		f := o.info(name)
+		f.LastModified = o.lastModified.Truncate(time.Microsecond)
+		f.LastModifiedStr = f.LastModified.Format(lastModifiedLayout)
+		info = append(info, f)
+	}
+	for subdir := range subdirs {
+		info = append(info, storage.ObjectInfo{Subdir: subdir})
+	}
+	sort.Slice(info, func(i, j int) bool {
+		return info[i].Name+info[i].Subdir < info[j].Name+info[j].Subdir
+	})
+	if list.Marker != "" {
+		i := sort.Search(len(info), func(i int) bool {
+			return info[i].Name+info[i].Subdir > list.Marker
+		})
+		info = info[i:]
+	}
+	// storage returns at most ListLimit objects
+	limit := storage.ListLimit
+	if list.Limit > 0 && list.Limit < limit {
+		limit = list.Limit
+	}
+	if len(info) > limit {
+		info = info[:limit]
+	}
+	return info, nil
+}
+
+func (c *memoryContainer) info(name string) storage.ContainerInfo {
+	info := storage.ContainerInfo{
+		Name:            name,
+		Type:            c.containerType,
+		RecievedBytes:   c.recievedBytes,
+		TransferedBytes: c.transferedBytes,
+	}
+	for _, o := range c.objects {
+		info.ObjectCount++
+		info.BytesUsed += uint64(len(o.data))
+	}
+	return info
+}
+
+// ContainerInfo returns information about container
+func (m *Memory) ContainerInfo(name string) (info storage.ContainerInfo, err error) {
+	m.record("ContainerInfo", name)
+	if badName(name) {
+		return info, storage.ErrorBadName
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.containers[name]
+	if !ok {
+		return info, storage.ErrorObjectNotFound
+	}
+	return c.info(name), nil
+}
+
+// ContainersInfo returns information about all containers sorted by name
+func (m *Memory) ContainersInfo() ([]storage.ContainerInfo, error) {
+	m.record("ContainersInfo")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	info := []storage.ContainerInfo{}
+	for name, c := range m.containers {
+		info = append(info, c.info(name))
+	}
+	sort.Slice(info, func(i, j int) bool {
+		return info[i].Name < info[j].Name
+	})
+	return info, nil
+}
+
+// Containers returns all containers
+func (m *Memory) Containers() ([]storage.ContainerAPI, error) {
+	info, err := m.ContainersInfo()
+	if err != nil {
+		return nil, err
+	}
+	containers := []storage.ContainerAPI{}
+	for _, c := range info {
+		containers = append(containers, m.Container(c.Name))
+	}
+	return containers, nil
+}
+
+// Credentials returns token and url of memory storage
+func (m *Memory) Credentials() (cache storage.ClientCredentials) {
+	m.record("Credentials")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cache.Token = m.token
+	cache.Debug = m.debug
+	cache.URL = memoryURL
+	return cache
+}
+
+// Dump returns gob-encoded Credentials
+func (m *Memory) Dump() ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	encoder := gob.NewEncoder(buffer)
+	if err := encoder.Encode(m.Credentials()); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// download returns copy of object data and counts download, m.mu must be held
+func (m *Memory) download(container, filename string) ([]byte, *memoryObject, error) {
+	c, o, err := m.object(container, filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	content, _ := m.content(o)
+	o.downloaded++
+	c.transferedBytes += uint64(len(content))
+	data := make([]byte, len(content))
+	copy(data, content)
+	return data, o, nil
+}
+
+// Do serves GET and HEAD requests for urls returned by Memory.URL
+func (m *Memory) Do(request *http.Request) (*http.Response, error) {
+	m.record("Do", request.Method, request.URL.String())
+	recorder := httptest.NewRecorder()
+	path := strings.TrimPrefix(request.URL.String(), memoryURL)
+	parts := strings.SplitN(path, "/", 2)
+	if len(parts) != 2 || path == request.URL.String() {
+		recorder.WriteHeader(http.StatusBadRequest)
+		return recorder.Result(), nil
+	}
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		recorder.WriteHeader(http.StatusMethodNotAllowed)
+		return recorder.Result(), nil
+	}
+	var (
+		data []byte
+		o    *memoryObject
+		err  error
+	)
+	m.mu.Lock()
+	if request.Method == http.MethodGet {
+		data, o, err = m.download(parts[0], parts[1])
+	} else {
+		_, o, err = m.object(parts[0], parts[1])
+	}
+	if err == nil {
+		content, hash := m.content(o)
+		header := recorder.Header()
+		header.Set("Etag", hash)
+		header.Set("Content-Type", o.contentType)
+		header.Set("Content-Length", strconv.Itoa(len(content)))
+		header.Set("Last-Modified", o.lastModified.Format(http.TimeFormat))
+		if o.encoding != "" {
+			header.Set("Content-Encoding", o.encoding)
+		}
+		header.Set("X-Object-Downloads", strconv.FormatUint(o.downloaded, 10))
+		for key, value := range o.metadata {
+			header.Set("X-Object-Meta-"+key, value)
+		}
+	}
+	m.mu.Unlock()
+	switch err {
+	case nil:
+		recorder.WriteHeader(http.StatusOK)
+		recorder.Write(data)
+	case storage.ErrorObjectNotFound:
+		recorder.WriteHeader(http.StatusNotFound)
+	default:
+		recorder.WriteHeader(http.StatusBadRequest)
+	}
+	return recorder.Result(), nil
+}
+
+// MemoryContainer is ContainerAPI of Memory storage
+type MemoryContainer struct {
+	name string
+	m    *Memory
+}
+
+// Name returns container name
+func (c *MemoryContainer) Name() string {
+	return c.name
+}
+
+// Upload is shortcut to Memory.Upload
+func (c *MemoryContainer) Upload(reader io.Reader, name, contentType string, opts ...storage.TransferOption) error {
+	return c.m.Upload(reader, c.name, name, contentType, opts...)
+}
+
+// UploadFile is shortcut to Memory.UploadFile
+func (c *MemoryContainer) UploadFile(filename string, opts ...storage.TransferOption) error {
+	return c.m.UploadFile(filename, c.name, opts...)
+}
+
+// URL is shortcut to Memory.URL
+func (c *MemoryContainer) URL(filename string) string {
+	return c.m.URL(c.name, filename)
+}
+
+// RemoveObject is shortcut to Memory.RemoveObject
+func (c *MemoryContainer) RemoveObject(name string) error {
+	return c.m.RemoveObject(c.name, name)
+}
+
+// Remove is shortcut to Memory.RemoveContainer
+func (c *MemoryContainer) Remove() error {
+	return c.m.RemoveContainer(c.name)
+}
+
+// Create is shortcut to Memory.CreateContainer
+func (c *MemoryContainer) Create(private bool) error {
+	_, err := c.m.CreateContainer(c.name, private)
+	return err
+}
+
+// ObjectInfo is shortcut to Memory.ObjectInfo
+func (c *MemoryContainer) ObjectInfo(name string) (storage.ObjectInfo, error) {
+	return c.m.ObjectInfo(c.name, name)
+}
+
+// Object returns ObjectAPI for object in container
+func (c *MemoryContainer) Object(name string) storage.ObjectAPI {
+	return &MemoryObject{name: name, container: c}
+}
+
+// ObjectsInfo is shortcut to Memory.ObjectsInfo
+func (c *MemoryContainer) ObjectsInfo(opts ...storage.ListOption) ([]storage.ObjectInfo, error) {
+	return c.m.ObjectsInfo(c.name, opts...)
+}
+
+// Objects returns all objects in container
+func (c *MemoryContainer) Objects() ([]storage.ObjectAPI, error) {
+	info, err := c.ObjectsInfo()
+	if err != nil {
+		return nil, err
+	}
+	objects := []storage.ObjectAPI{}
+	for _, object := range info {
+		objects = append(objects, c.Object(object.Name))
+	}
+	return objects, nil
+}
+
+// Info is shortcut to Memory.ContainerInfo
+func (c *MemoryContainer) Info() (storage.ContainerInfo, error) {
+	return c.m.ContainerInfo(c.name)
+}
+
+// MemoryObject is ObjectAPI of Memory storage
+type MemoryObject struct {
+	name      string
+	container *MemoryContainer
+}
+
+// Info returns information about object
+func (o *MemoryObject) Info() (storage.ObjectInfo, error) {
+	return o.container.ObjectInfo(o.name)
+}
+
+// Remove removes object
+func (o *MemoryObject) Remove() error {
+	return o.container.RemoveObject(o.name)
+}
+
+// Download returns object data and counts download
+func (o *MemoryObject) Download() ([]byte, error) {
+	reader, err := o.GetReader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Upload stores data from reader as object
+func (o *MemoryObject) Upload(reader io.Reader, contentType string, opts ...storage.TransferOption) error {
+	return o.container.Upload(reader, o.name, contentType, opts...)
+}
+
+// UploadFile stores file in container with its base name
+func (o *MemoryObject) UploadFile(filename string, opts ...storage.TransferOption) error {
+	return o.container.UploadFile(filename, opts...)
+}
+
+// GetReader returns reader for object data or its range and counts
+// download, compressed data is decompressed and other transfer options
+// are ignored
+func (o *MemoryObject) GetReader(opts ...storage.TransferOption) (io.ReadCloser, error) {
+	m := o.container.m
+	m.record("GetReader", o.container.name, o.name)
+	m.mu.Lock()
+	data, object, err := m.download(o.container.name, o.name)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if object.encoding != "" {
+		if data, err = decompress(data, object.encoding); err != nil {
+			return nil, err
+		}
+	}
+	offset, length := storage.RequestedRange(opts...)
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
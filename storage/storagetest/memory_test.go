@@ -0,0 +1,170 @@
+package storagetest
+
+import (
+	"bytes"
+	"github.com/ernado/selectel/storage"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMemoryConformance(t *testing.T) {
+	RunAPITests(t, func() storage.API {
+		return NewMemory()
+	})
+}
+
+func TestMemory(t *testing.T) {
+	Convey("Memory", t, func() {
+		m := NewMemory()
+		container, err := m.CreateContainer("container", true)
+		So(err, ShouldBeNil)
+		data := randData(dataLength)
+		So(container.Upload(bytes.NewBuffer(data), "object", contentType), ShouldBeNil)
+		Convey("Calls", func() {
+			calls := m.Calls()
+			So(len(calls), ShouldEqual, 2)
+			So(calls[0].Method, ShouldEqual, "CreateContainer")
+			So(calls[0].Args[0], ShouldEqual, "container")
+			So(calls[0].Args[1], ShouldEqual, true)
+			So(calls[1].Method, ShouldEqual, "Upload")
+			So(calls[1].Args[1], ShouldEqual, "object")
+			So(m.CallCount("Upload"), ShouldEqual, 1)
+			m.ResetCalls()
+			So(len(m.Calls()), ShouldEqual, 0)
+		})
+		Convey("Downloads", func() {
+			_, err := container.Object("object").Download()
+			So(err, ShouldBeNil)
+			_, err = container.Object("object").Download()
+			So(err, ShouldBeNil)
+			info, err := container.ObjectInfo("object")
+			So(err, ShouldBeNil)
+			So(info.Downloaded, ShouldEqual, 2)
+			containerInfo, err := container.Info()
+			So(err, ShouldBeNil)
+			So(containerInfo.TransferedBytes, ShouldEqual, 2*dataLength)
+			So(containerInfo.RecievedBytes, ShouldEqual, dataLength)
+		})
+		Convey("List options", func() {
+			for _, name := range []string{"a/1", "a/b/2", "a/b/3", "c"} {
+				So(container.Upload(bytes.NewBufferString(name), name, contentType), ShouldBeNil)
+			}
+			info, err := container.ObjectsInfo(storage.Prefix("a/"), storage.Delimiter("/"))
+			So(err, ShouldBeNil)
+			So(info, ShouldHaveLength, 2)
+			So(info[0].Name, ShouldEqual, "a/1")
+			So(info[1].Subdir, ShouldEqual, "a/b/")
+			info, err = container.ObjectsInfo(storage.Delimiter("/"))
+			So(err, ShouldBeNil)
+			So(info, ShouldHaveLength, 3)
+			So(info[0].Subdir, ShouldEqual, "a/")
+			So(info[1].Name, ShouldEqual, "c")
+			So(info[2].Name, ShouldEqual, "object")
+			info, err = container.ObjectsInfo(storage.Prefix("a/b"))
+			So(err, ShouldBeNil)
+			So(info, ShouldHaveLength, 2)
+		})
+		Convey("Range", func() {
+			reader, err := container.Object("object").GetReader(storage.Range(10, 5))
+			So(err, ShouldBeNil)
+			part, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(part, ShouldResemble, data[10:15])
+			reader, err = container.Object("object").GetReader(storage.Range(dataLength+1, 0))
+			So(err, ShouldBeNil)
+			part, err = ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(part, ShouldBeEmpty)
+		})
+		Convey("Metadata", func() {
+			So(container.Upload(bytes.NewBufferString("data"), "meta", "text/plain", storage.Metadata("original-size", "10")), ShouldBeNil)
+			info, err := container.ObjectInfo("meta")
+			So(err, ShouldBeNil)
+			So(info.Metadata, ShouldResemble, map[string]string{"Original-Size": "10"})
+			request, _ := http.NewRequest("HEAD", m.URL("container", "meta"), nil)
+			res, err := m.Do(request)
+			So(err, ShouldBeNil)
+			So(res.Header.Get("X-Object-Meta-Original-Size"), ShouldEqual, "10")
+		})
+		Convey("Compress", func() {
+			data := strings.Repeat("data", 100)
+			So(container.Upload(bytes.NewBufferString(data), "gzip", "text/plain", storage.Compress(storage.EncodingGzip)), ShouldBeNil)
+			info, err := container.ObjectInfo("gzip")
+			So(err, ShouldBeNil)
+			So(info.ContentEncoding, ShouldEqual, storage.EncodingGzip)
+			So(info.Size, ShouldEqual, len(data))
+			So(info.StoredSize, ShouldBeLessThan, len(data))
+			downloaded, err := container.Object("gzip").Download()
+			So(err, ShouldBeNil)
+			So(string(downloaded), ShouldEqual, data)
+			reader, err := container.Object("gzip").GetReader(storage.Range(4, 4))
+			So(err, ShouldBeNil)
+			downloaded, _ = ioutil.ReadAll(reader)
+			So(string(downloaded), ShouldEqual, "data")
+			request, _ := http.NewRequest("HEAD", m.URL("container", "gzip"), nil)
+			res, err := m.Do(request)
+			So(err, ShouldBeNil)
+			So(res.Header.Get("Content-Encoding"), ShouldEqual, storage.EncodingGzip)
+			So(container.Upload(bytes.NewBufferString(data), "bad", "text/plain", storage.Compress("br")), ShouldEqual, storage.ErrorBadEncoding)
+		})
+		Convey("Manifest", func() {
+			So(container.Upload(bytes.NewBufferString("two"), "segments/2", "text/plain"), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString("one "), "segments/1", "text/plain"), ShouldBeNil)
+			So(container.Upload(bytes.NewBufferString(""), "large", "text/plain", storage.Manifest("container/segments/")), ShouldBeNil)
+			data, err := container.Object("large").Download()
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "one two")
+			info, err := container.ObjectInfo("large")
+			So(err, ShouldBeNil)
+			So(info.Size, ShouldEqual, 7)
+			So(info.Hash, ShouldEqual, hash([]byte(hash([]byte("one "))+hash([]byte("two")))))
+		})
+		Convey("Info", func() {
+			info := m.Info()
+			So(info.ContainerCount, ShouldEqual, 1)
+			So(info.ObjectCount, ShouldEqual, 1)
+			So(info.BytesUsed, ShouldEqual, dataLength)
+		})
+		Convey("Do", func() {
+			Convey("Head", func() {
+				request, _ := http.NewRequest("HEAD", m.URL("container", "object"), nil)
+				res, err := m.Do(request)
+				So(err, ShouldBeNil)
+				So(res.StatusCode, ShouldEqual, http.StatusOK)
+				So(res.Header.Get("etag"), ShouldEqual, hash(data))
+				body, _ := ioutil.ReadAll(res.Body)
+				So(len(body), ShouldEqual, 0)
+			})
+			Convey("Not found", func() {
+				request, _ := http.NewRequest("GET", m.URL("container", "missing"), nil)
+				res, err := m.Do(request)
+				So(err, ShouldBeNil)
+				So(res.StatusCode, ShouldEqual, http.StatusNotFound)
+			})
+			Convey("Bad method", func() {
+				request, _ := http.NewRequest("PUT", m.URL("container", "object"), nil)
+				res, err := m.Do(request)
+				So(err, ShouldBeNil)
+				So(res.StatusCode, ShouldEqual, http.StatusMethodNotAllowed)
+			})
+			Convey("Bad url", func() {
+				request, _ := http.NewRequest("GET", "http://example.com/container/object", nil)
+				res, err := m.Do(request)
+				So(err, ShouldBeNil)
+				So(res.StatusCode, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+		Convey("Content type", func() {
+			So(container.Upload(bytes.NewBufferString("<html></html>"), "page", ""), ShouldBeNil)
+			info, err := container.ObjectInfo("page")
+			So(err, ShouldBeNil)
+			So(info.ContentType, ShouldEqual, "text/html; charset=utf-8")
+		})
+		Convey("Upload to missing container", func() {
+			So(m.Upload(bytes.NewBuffer(data), "missing", "object", contentType), ShouldEqual, storage.ErrorBadResponce)
+		})
+	})
+}
@@ -0,0 +1,345 @@
+// Package storagetest provides conformance tests for storage.API implementations,
+// so wrappers and fakes can be checked to behave like the real client.
+package storagetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/ernado/selectel/storage"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	containerPrefix = "storagetest-"
+	contentType     = "text/plain"
+	nameLength      = 12
+	dataLength      = 512
+	badNameLength   = 512
+)
+
+// Factory returns API implementation for single test case
+type Factory func() storage.API
+
+func randData(n int) []byte {
+	const alphanum = "0123456789abcdefghijklmnopqrstuvwxyz"
+	var bytes = make([]byte, n)
+	rand.Read(bytes)
+	for i, b := range bytes {
+		bytes[i] = alphanum[b%byte(len(alphanum))]
+	}
+	return bytes
+}
+
+func randString(n int) string {
+	return string(randData(n))
+}
+
+func hash(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cleanup removes all objects from container and container itself
+func cleanup(api storage.API, container string) {
+	objects, _ := api.ObjectsInfo(container)
+	for _, object := range objects {
+		api.RemoveObject(container, object.Name)
+	}
+	api.RemoveContainer(container)
+}
+
+func containsContainer(info []storage.ContainerInfo, name string) bool {
+	for _, v := range info {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func findObject(info []storage.ObjectInfo, name string) (storage.ObjectInfo, bool) {
+	for _, v := range info {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return storage.ObjectInfo{}, false
+}
+
+// tempFile creates temporary file with provided data and returns its path
+func tempFile(data []byte) string {
+	f, err := ioutil.TempFile("", containerPrefix)
+	So(err, ShouldBeNil)
+	defer f.Close()
+	_, err = f.Write(data)
+	So(err, ShouldBeNil)
+	return f.Name()
+}
+
+// RunAPITests runs conformance tests for API, ContainerAPI and ObjectAPI
+// implementations returned by factory.
+// Every test case uses new randomly named container and removes it on exit.
+func RunAPITests(t *testing.T, factory Factory) {
+	Convey("API conformance", t, func() {
+		api := factory()
+		So(api, ShouldNotBeNil)
+		name := containerPrefix + randString(nameLength)
+		container, err := api.CreateContainer(name, false)
+		So(err, ShouldBeNil)
+		So(container, ShouldNotBeNil)
+		So(container.Name(), ShouldEqual, name)
+		Reset(func() {
+			cleanup(api, name)
+		})
+		data := randData(dataLength)
+		objectName := randString(nameLength)
+
+		Convey("Auth", func() {
+			So(api.Auth("", ""), ShouldEqual, storage.ErrorBadCredentials)
+			So(api.Auth("user", ""), ShouldEqual, storage.ErrorBadCredentials)
+			So(api.Auth("", "key"), ShouldEqual, storage.ErrorBadCredentials)
+			So(api.Token(), ShouldNotEqual, "")
+			api.Debug(false)
+		})
+		Convey("Credentials", func() {
+			So(api.Credentials().Token, ShouldEqual, api.Token())
+			_, err := api.Dump()
+			So(err, ShouldBeNil)
+		})
+		Convey("Info", func() {
+			So(func() {
+				api.Info()
+			}, ShouldNotPanic)
+		})
+		Convey("Containers", func() {
+			Convey("Create existing", func() {
+				c, err := api.CreateContainer(name, false)
+				So(err, ShouldBeNil)
+				So(c.Name(), ShouldEqual, name)
+			})
+			Convey("Shortcuts", func() {
+				So(api.C(name).Name(), ShouldEqual, name)
+				So(api.Container(name).Name(), ShouldEqual, name)
+			})
+			Convey("Info", func() {
+				info, err := api.ContainerInfo(name)
+				So(err, ShouldBeNil)
+				So(info.ObjectCount, ShouldEqual, 0)
+				So(info.Type, ShouldEqual, "public")
+				info, err = container.Info()
+				So(err, ShouldBeNil)
+				So(info.ObjectCount, ShouldEqual, 0)
+			})
+			Convey("Info not found", func() {
+				_, err := api.ContainerInfo(randString(nameLength))
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("List", func() {
+				info, err := api.ContainersInfo()
+				So(err, ShouldBeNil)
+				So(containsContainer(info, name), ShouldBeTrue)
+				containers, err := api.Containers()
+				So(err, ShouldBeNil)
+				found := false
+				for _, c := range containers {
+					if c.Name() == name {
+						found = true
+					}
+				}
+				So(found, ShouldBeTrue)
+			})
+			Convey("Remove", func() {
+				So(api.RemoveContainer(name), ShouldBeNil)
+				_, err := api.ContainerInfo(name)
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Remove not found", func() {
+				So(api.RemoveContainer(randString(nameLength)), ShouldEqual, storage.ErrorObjectNotFound)
+				So(api.Container(randString(nameLength)).Remove(), ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Remove not empty", func() {
+				So(api.Upload(bytes.NewBuffer(data), name, objectName, contentType), ShouldBeNil)
+				So(api.RemoveContainer(name), ShouldEqual, storage.ErrorConianerNotEmpty)
+				So(container.Remove(), ShouldEqual, storage.ErrorConianerNotEmpty)
+			})
+			Convey("Create shortcut", func() {
+				other := containerPrefix + randString(nameLength)
+				c := api.Container(other)
+				So(c.Create(true), ShouldBeNil)
+				Reset(func() {
+					cleanup(api, other)
+				})
+				info, err := c.Info()
+				So(err, ShouldBeNil)
+				So(info.Type, ShouldEqual, "private")
+			})
+			Convey("Bad name", func() {
+				_, err := api.ContainerInfo(randString(badNameLength))
+				So(err, ShouldEqual, storage.ErrorBadName)
+				_, err = api.CreateContainer(randString(badNameLength), false)
+				So(err, ShouldEqual, storage.ErrorBadName)
+			})
+		})
+		Convey("Objects", func() {
+			So(api.Upload(bytes.NewBuffer(data), name, objectName, contentType), ShouldBeNil)
+			Convey("Info", func() {
+				info, err := api.ObjectInfo(name, objectName)
+				So(err, ShouldBeNil)
+				So(info.Name, ShouldEqual, objectName)
+				So(info.Size, ShouldEqual, dataLength)
+				So(info.Hash, ShouldEqual, hash(data))
+				So(info.ContentType, ShouldEqual, contentType)
+				So(info.LastModified.IsZero(), ShouldBeFalse)
+				info, err = container.ObjectInfo(objectName)
+				So(err, ShouldBeNil)
+				So(info.Hash, ShouldEqual, hash(data))
+				info, err = container.Object(objectName).Info()
+				So(err, ShouldBeNil)
+				So(info.Hash, ShouldEqual, hash(data))
+			})
+			Convey("Info not found", func() {
+				_, err := api.ObjectInfo(name, randString(nameLength))
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+				_, err = container.Object(randString(nameLength)).Info()
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("List", func() {
+				info, err := api.ObjectsInfo(name)
+				So(err, ShouldBeNil)
+				object, ok := findObject(info, objectName)
+				So(ok, ShouldBeTrue)
+				So(object.Size, ShouldEqual, dataLength)
+				So(object.Hash, ShouldEqual, hash(data))
+				So(object.LastModified.IsZero(), ShouldBeFalse)
+				info, err = container.ObjectsInfo()
+				So(err, ShouldBeNil)
+				_, ok = findObject(info, objectName)
+				So(ok, ShouldBeTrue)
+				objects, err := container.Objects()
+				So(err, ShouldBeNil)
+				So(len(objects), ShouldEqual, len(info))
+			})
+			Convey("List pages", func() {
+				for _, suffix := range []string{"a", "b", "c"} {
+					So(container.Upload(bytes.NewBuffer(data), objectName+suffix, contentType), ShouldBeNil)
+				}
+				info, err := container.ObjectsInfo(storage.Prefix(objectName), storage.Limit(2))
+				So(err, ShouldBeNil)
+				So(info, ShouldHaveLength, 2)
+				So(info[0].Name, ShouldEqual, objectName)
+				info, err = container.ObjectsInfo(storage.Prefix(objectName), storage.Marker(info[1].Name))
+				So(err, ShouldBeNil)
+				So(info, ShouldHaveLength, 2)
+				So(info[1].Name, ShouldEqual, objectName+"c")
+				info, err = storage.AllObjectsInfo(container, storage.Prefix(objectName), storage.Limit(1))
+				So(err, ShouldBeNil)
+				So(info, ShouldHaveLength, 4)
+			})
+			Convey("List not found", func() {
+				_, err := api.ObjectsInfo(randString(nameLength))
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Overwrite", func() {
+				updated := randData(dataLength * 2)
+				So(container.Upload(bytes.NewBuffer(updated), objectName, contentType), ShouldBeNil)
+				info, err := api.ObjectInfo(name, objectName)
+				So(err, ShouldBeNil)
+				So(info.Size, ShouldEqual, len(updated))
+				So(info.Hash, ShouldEqual, hash(updated))
+			})
+			Convey("Download", func() {
+				object := container.Object(objectName)
+				downloaded, err := object.Download()
+				So(err, ShouldBeNil)
+				So(bytes.Equal(downloaded, data), ShouldBeTrue)
+				reader, err := object.GetReader()
+				So(err, ShouldBeNil)
+				downloaded, err = ioutil.ReadAll(reader)
+				reader.Close()
+				So(err, ShouldBeNil)
+				So(bytes.Equal(downloaded, data), ShouldBeTrue)
+			})
+			Convey("Download not found", func() {
+				object := container.Object(randString(nameLength))
+				_, err := object.Download()
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+				_, err = object.GetReader()
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Do", func() {
+				request, err := http.NewRequest("GET", api.URL(name, objectName), nil)
+				So(err, ShouldBeNil)
+				res, err := api.Do(request)
+				So(err, ShouldBeNil)
+				defer res.Body.Close()
+				So(res.StatusCode, ShouldEqual, http.StatusOK)
+				downloaded, err := ioutil.ReadAll(res.Body)
+				So(err, ShouldBeNil)
+				So(bytes.Equal(downloaded, data), ShouldBeTrue)
+			})
+			Convey("URL", func() {
+				url := api.URL(name, objectName)
+				So(strings.HasSuffix(url, name+"/"+objectName), ShouldBeTrue)
+				So(container.URL(objectName), ShouldEqual, url)
+			})
+			Convey("Remove", func() {
+				So(api.RemoveObject(name, objectName), ShouldBeNil)
+				_, err := api.ObjectInfo(name, objectName)
+				So(err, ShouldEqual, storage.ErrorObjectNotFound)
+				So(api.RemoveContainer(name), ShouldBeNil)
+			})
+			Convey("Remove shortcuts", func() {
+				So(container.Object(objectName).Remove(), ShouldBeNil)
+				So(container.RemoveObject(objectName), ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Remove not found", func() {
+				So(api.RemoveObject(name, randString(nameLength)), ShouldEqual, storage.ErrorObjectNotFound)
+			})
+			Convey("Upload shortcut", func() {
+				other := randString(nameLength)
+				So(container.Object(other).Upload(bytes.NewBuffer(data), contentType), ShouldBeNil)
+				info, err := container.ObjectInfo(other)
+				So(err, ShouldBeNil)
+				So(info.Hash, ShouldEqual, hash(data))
+			})
+			Convey("Bad name", func() {
+				So(api.Upload(bytes.NewBuffer(data), name, randString(badNameLength), contentType), ShouldEqual, storage.ErrorBadName)
+				_, err := api.ObjectInfo(name, randString(badNameLength))
+				So(err, ShouldEqual, storage.ErrorBadName)
+				So(api.RemoveObject(name, randString(badNameLength)), ShouldEqual, storage.ErrorBadName)
+			})
+		})
+		Convey("Files", func() {
+			filename := tempFile(data)
+			Reset(func() {
+				os.Remove(filename)
+			})
+			basename := filepath.Base(filename)
+			Convey("Upload", func() {
+				So(api.UploadFile(filename, name), ShouldBeNil)
+				info, err := api.ObjectInfo(name, basename)
+				So(err, ShouldBeNil)
+				So(info.Size, ShouldEqual, dataLength)
+				So(info.Hash, ShouldEqual, hash(data))
+			})
+			Convey("Shortcuts", func() {
+				So(container.UploadFile(filename), ShouldBeNil)
+				So(container.Object(basename).UploadFile(filename), ShouldBeNil)
+				info, err := container.ObjectInfo(basename)
+				So(err, ShouldBeNil)
+				So(info.Hash, ShouldEqual, hash(data))
+			})
+			Convey("Not found", func() {
+				So(api.UploadFile(filename+randString(nameLength), name), ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,22 @@
+package storagetest
+
+import (
+	"github.com/ernado/selectel/storage"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	if len(os.Getenv(storage.EnvKey)) == 0 || len(os.Getenv(storage.EnvUser)) == 0 {
+		log.Println("Credentials not provided. Skipping client conformance tests")
+		return
+	}
+	RunAPITests(t, func() storage.API {
+		api, err := storage.NewEnv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return api
+	})
+}
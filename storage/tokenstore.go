@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// EnvToken is environmental variable for auth token, used by EnvTokenStore
+	EnvToken = "SELECTEL_TOKEN"
+	// EnvStorageURL is environmental variable for storage url, used by EnvTokenStore
+	EnvStorageURL = "SELECTEL_STORAGE_URL"
+	// EnvTokenExpires is environmental variable for token expiration unix time, used by EnvTokenStore
+	EnvTokenExpires = "SELECTEL_TOKEN_EXPIRES"
+	tokenFileMode   = 0600
+	tokenDirMode    = 0700
+)
+
+var (
+	// ErrorTokenNotFound occurs when token store has no token
+	ErrorTokenNotFound = errors.New("Token not found in store")
+	// ErrorBadTokenFile occurs when token file can not be decrypted
+	ErrorBadTokenFile = errors.New("Unable to decrypt token file")
+)
+
+// TokenStore keeps auth token, so it can be shared between clients.
+// Client loads token from store before authentication and saves it after.
+type TokenStore interface {
+	// Load returns stored credentials or ErrorTokenNotFound
+	Load() (ClientCredentials, error)
+	// Save stores credentials
+	Save(cache ClientCredentials) error
+}
+
+// MemoryTokenStore shares token between clients of one process
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	cache *ClientCredentials
+}
+
+// NewMemoryTokenStore returns new empty MemoryTokenStore
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return new(MemoryTokenStore)
+}
+
+// Load returns saved credentials
+func (s *MemoryTokenStore) Load() (ClientCredentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cache == nil {
+		return ClientCredentials{}, ErrorTokenNotFound
+	}
+	return *s.cache, nil
+}
+
+// Save stores credentials in memory
+func (s *MemoryTokenStore) Save(cache ClientCredentials) error {
+	s.mu.Lock()
+	s.cache = &cache
+	s.mu.Unlock()
+	return nil
+}
+
+// FileTokenStore keeps token in json file, that is readable only by owner.
+// If Key is set, file is encrypted with AES-GCM.
+type FileTokenStore struct {
+	Path string
+	Key  []byte
+}
+
+// NewFileTokenStore returns FileTokenStore for path
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (s *FileTokenStore) aead() (cipher.AEAD, error) {
+	key := sha256.Sum256(s.Key)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Load reads credentials from file
+func (s *FileTokenStore) Load() (cache ClientCredentials, err error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return cache, ErrorTokenNotFound
+	}
+	if err != nil {
+		return cache, err
+	}
+	if len(s.Key) > 0 {
+		gcm, err := s.aead()
+		if err != nil {
+			return cache, err
+		}
+		if len(data) < gcm.NonceSize() {
+			return cache, ErrorBadTokenFile
+		}
+		nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+		if data, err = gcm.Open(nil, nonce, ciphertext, nil); err != nil {
+			return cache, ErrorBadTokenFile
+		}
+	}
+	if err = json.Unmarshal(data, &cache); err != nil {
+		return cache, ErrorBadJSON
+	}
+	return cache, nil
+}
+
+// Save writes credentials to file, creating parent directories
+func (s *FileTokenStore) Save(cache ClientCredentials) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if len(s.Key) > 0 {
+		gcm, err := s.aead()
+		if err != nil {
+			return err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return err
+		}
+		data = gcm.Seal(nonce, nonce, data, nil)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), tokenDirMode); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.Path, data, tokenFileMode)
+}
+
+// EnvTokenStore keeps token in environment of current process,
+// so it is inherited by child processes
+type EnvTokenStore struct {
+	// Clock is used to calculate token lifetime, SystemClock if nil
+	Clock Clock
+}
+
+// Load reads token, storage url and expiration time from environment
+func (s EnvTokenStore) Load() (cache ClientCredentials, err error) {
+	cache.Token = os.Getenv(EnvToken)
+	cache.URL = os.Getenv(EnvStorageURL)
+	if blank(cache.Token) || blank(cache.URL) {
+		return cache, ErrorTokenNotFound
+	}
+	expires, err := strconv.ParseInt(os.Getenv(EnvTokenExpires), 10, 64)
+	if err != nil {
+		return cache, ErrorTokenNotFound
+	}
+	now := clockOrSystem(s.Clock).Now()
+	cache.ExpireFrom = &now
+	cache.Expire = int(time.Unix(expires, 0).Sub(now) / time.Second)
+	return cache, nil
+}
+
+// Save sets token, storage url and expiration time in environment
+func (EnvTokenStore) Save(cache ClientCredentials) error {
+	if cache.ExpireFrom == nil {
+		return ErrorTokenNotFound
+	}
+	expires := cache.ExpireFrom.Add(time.Duration(cache.Expire) * time.Second)
+	if err := os.Setenv(EnvToken, cache.Token); err != nil {
+		return err
+	}
+	if err := os.Setenv(EnvStorageURL, cache.URL); err != nil {
+		return err
+	}
+	return os.Setenv(EnvTokenExpires, strconv.FormatInt(expires.Unix(), 10))
+}
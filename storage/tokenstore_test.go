@@ -0,0 +1,194 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	Convey("Token store", t, func() {
+		now := time.Now()
+		cache := ClientCredentials{
+			Token:      "token",
+			URL:        "https://xxx.selcdn.ru/",
+			Expire:     110,
+			ExpireFrom: &now,
+			User:       "user",
+		}
+		Convey("Memory", func() {
+			store := NewMemoryTokenStore()
+			_, err := store.Load()
+			So(err, ShouldEqual, ErrorTokenNotFound)
+			So(store.Save(cache), ShouldBeNil)
+			loaded, err := store.Load()
+			So(err, ShouldBeNil)
+			So(loaded.Token, ShouldEqual, "token")
+			So(loaded.User, ShouldEqual, "user")
+		})
+		Convey("File", func() {
+			dir, err := ioutil.TempDir("", "selectel")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "cache", "token.json")
+			store := NewFileTokenStore(path)
+			Convey("Not found", func() {
+				_, err := store.Load()
+				So(err, ShouldEqual, ErrorTokenNotFound)
+			})
+			Convey("Ok", func() {
+				So(store.Save(cache), ShouldBeNil)
+				stat, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(stat.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+				loaded, err := store.Load()
+				So(err, ShouldBeNil)
+				So(loaded.Token, ShouldEqual, "token")
+				So(loaded.URL, ShouldEqual, "https://xxx.selcdn.ru/")
+				So(loaded.Expire, ShouldEqual, 110)
+				So(loaded.ExpireFrom.Equal(now), ShouldBeTrue)
+				So(loaded.Expired(), ShouldBeFalse)
+			})
+			Convey("Bad json", func() {
+				So(os.MkdirAll(filepath.Dir(path), 0700), ShouldBeNil)
+				So(ioutil.WriteFile(path, []byte("{"), 0600), ShouldBeNil)
+				_, err := store.Load()
+				So(err, ShouldEqual, ErrorBadJSON)
+			})
+			Convey("Encrypted", func() {
+				store.Key = []byte("secret")
+				So(store.Save(cache), ShouldBeNil)
+				data, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldNotContainSubstring, "token")
+				loaded, err := store.Load()
+				So(err, ShouldBeNil)
+				So(loaded.Token, ShouldEqual, "token")
+				Convey("Bad key", func() {
+					store := &FileTokenStore{Path: path, Key: []byte("other")}
+					_, err := store.Load()
+					So(err, ShouldEqual, ErrorBadTokenFile)
+				})
+				Convey("Short", func() {
+					So(ioutil.WriteFile(path, []byte("x"), 0600), ShouldBeNil)
+					_, err := store.Load()
+					So(err, ShouldEqual, ErrorBadTokenFile)
+				})
+			})
+		})
+		Convey("Env", func() {
+			defer os.Unsetenv(EnvToken)
+			defer os.Unsetenv(EnvStorageURL)
+			defer os.Unsetenv(EnvTokenExpires)
+			store := EnvTokenStore{}
+			_, err := store.Load()
+			So(err, ShouldEqual, ErrorTokenNotFound)
+			So(store.Save(cache), ShouldBeNil)
+			So(os.Getenv(EnvToken), ShouldEqual, "token")
+			loaded, err := store.Load()
+			So(err, ShouldBeNil)
+			So(loaded.Token, ShouldEqual, "token")
+			So(loaded.URL, ShouldEqual, "https://xxx.selcdn.ru/")
+			So(loaded.Expire, ShouldBeGreaterThan, 100)
+			So(loaded.Expired(), ShouldBeFalse)
+			So(store.Save(ClientCredentials{}), ShouldEqual, ErrorTokenNotFound)
+			Convey("Bad expire", func() {
+				os.Setenv(EnvTokenExpires, "never")
+				_, err := store.Load()
+				So(err, ShouldEqual, ErrorTokenNotFound)
+			})
+		})
+		Convey("Client", func() {
+			store := NewMemoryTokenStore()
+			var auths int
+			callback := func(request *http.Request) (*http.Response, error) {
+				resp := new(http.Response)
+				resp.Header = http.Header{}
+				if request.URL.String() == "https://auth.selcdn.ru/" {
+					auths++
+					resp.Header.Add("X-Expire-Auth-Token", "110")
+					resp.Header.Add("X-Auth-Token", "new")
+					resp.Header.Add("X-Storage-Url", "https://yyy.selcdn.ru/")
+					resp.StatusCode = http.StatusNoContent
+					return resp, nil
+				}
+				resp.StatusCode = http.StatusNoContent
+				if request.Header.Get("X-Auth-Token") == "rejected" {
+					resp.StatusCode = http.StatusUnauthorized
+				}
+				return resp, nil
+			}
+			c := newClient(WithHTTPClient(NewTestClient(callback)), WithTokenStore(store))
+			Convey("Save", func() {
+				So(c.Auth("user", "key"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+				loaded, err := store.Load()
+				So(err, ShouldBeNil)
+				So(loaded.Token, ShouldEqual, "new")
+				So(loaded.User, ShouldEqual, "user")
+				Convey("Shared", func() {
+					other := newClient(WithHTTPClient(NewTestClient(callback)), WithTokenStore(store))
+					So(other.Auth("user", "key"), ShouldBeNil)
+					So(auths, ShouldEqual, 1)
+					So(other.Token(), ShouldEqual, "new")
+				})
+			})
+			Convey("Load", func() {
+				So(store.Save(cache), ShouldBeNil)
+				So(c.Auth("user", "key"), ShouldBeNil)
+				So(auths, ShouldEqual, 0)
+				So(c.Token(), ShouldEqual, "token")
+				So(c.URL("c", "o"), ShouldEqual, "https://xxx.selcdn.ru/c/o")
+			})
+			Convey("Lazy", func() {
+				So(store.Save(cache), ShouldBeNil)
+				c.user, c.key = "user", "key"
+				So(c.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 0)
+			})
+			Convey("Other user", func() {
+				So(store.Save(cache), ShouldBeNil)
+				So(c.Auth("other", "key"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+			})
+			Convey("Expired", func() {
+				expireFrom := now.Add(-time.Hour)
+				cache.ExpireFrom = &expireFrom
+				So(store.Save(cache), ShouldBeNil)
+				So(c.Auth("user", "key"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+			})
+			Convey("New from store", func() {
+				_, err := NewFromStore(store)
+				So(err, ShouldEqual, ErrorTokenNotFound)
+				So(store.Save(cache), ShouldBeNil)
+				api, err := NewFromStore(store, WithHTTPClient(NewTestClient(callback)))
+				So(err, ShouldBeNil)
+				So(api.Token(), ShouldEqual, "token")
+				So(api.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 0)
+				Convey("Bad url", func() {
+					cache.URL = invalidHost
+					So(store.Save(cache), ShouldBeNil)
+					_, err := NewFromStore(store)
+					So(err, ShouldEqual, ErrorBadCredentials)
+				})
+			})
+			Convey("Rejected", func() {
+				cache.Token = "rejected"
+				So(store.Save(cache), ShouldBeNil)
+				c.user, c.key = "user", "key"
+				So(c.RemoveObject("c", "o"), ShouldBeNil)
+				So(auths, ShouldEqual, 1)
+				So(c.Token(), ShouldEqual, "new")
+				loaded, err := store.Load()
+				So(err, ShouldBeNil)
+				So(loaded.Token, ShouldEqual, "new")
+			})
+		})
+	})
+}
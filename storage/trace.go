@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+)
+
+// Attribute keys of spans
+const (
+	AttributeContainer = "storage.container"
+	AttributeObject    = "storage.object"
+	AttributeSize      = "storage.size"
+	AttributeOperation = "storage.operation"
+	AttributeAttempt   = "storage.attempt"
+	AttributeMethod    = "http.method"
+	AttributeURL       = "http.url"
+	AttributeStatus    = "http.status_code"
+	spanPrefix         = "storage."
+)
+
+// Attribute is key and value of span attribute
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans of api methods and http requests, it can be
+// implemented with OpenTelemetry tracer and propagator
+type Tracer interface {
+	// Start starts span, that is child of span from ctx
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	// Inject writes span context from ctx to headers of outgoing request
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span is operation, that is started by Tracer
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks span as failed
+	RecordError(err error)
+	End()
+}
+
+// WithTracer enables tracing, each api method starts span, that has
+// spans of hashing, authentication and http requests as children
+func WithTracer(tracer Tracer) Option {
+	return func(c *Client) {
+		c.tracer = tracer
+	}
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopTracer) Inject(ctx context.Context, header http.Header) {}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+func (noopSpan) RecordError(err error)            {}
+func (noopSpan) End()                             {}
+
+// spanKey is context key of api method span
+type spanKey struct{}
+
+// startSpan starts span of api method with container and object attributes
+func (c *Client) startSpan(ctx context.Context, method, container, object string) (context.Context, Span) {
+	var attrs []Attribute
+	if !blank(container) {
+		attrs = append(attrs, Attribute{AttributeContainer, container})
+	}
+	if !blank(object) {
+		attrs = append(attrs, Attribute{AttributeObject, object})
+	}
+	ctx, span := c.tracer.Start(ctx, spanPrefix+method, attrs...)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// startObjectSpan starts span with api client if it is *Client
+func startObjectSpan(api API, method, container, object string) (context.Context, Span) {
+	if c, ok := api.(*Client); ok {
+		return c.startSpan(context.Background(), method, container, object)
+	}
+	return context.Background(), noopSpan{}
+}
+
+// endSpan records error and ends span
+func endSpan(span Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+	}
+	span.End()
+}
+
+// traceInterceptor starts span of http request as child of api method span,
+// injects it to request headers and sets response status to both spans
+func (c *Client) traceInterceptor(next DoClient) DoClient {
+	return DoFunc(func(request *http.Request) (*http.Response, error) {
+		ctx, span := c.tracer.Start(request.Context(), "HTTP "+request.Method,
+			Attribute{AttributeMethod, request.Method},
+			Attribute{AttributeURL, redactURL(request.URL)},
+			Attribute{AttributeOperation, RequestOperation(request)},
+			Attribute{AttributeAttempt, attempt(request)},
+		)
+		if request.Header == nil {
+			request.Header = http.Header{}
+		}
+		c.tracer.Inject(ctx, request.Header)
+		res, err := next.Do(request)
+		if err != nil {
+			span.RecordError(err)
+			span.End()
+			return nil, err
+		}
+		status := Attribute{AttributeStatus, res.StatusCode}
+		span.SetAttributes(status)
+		if res.StatusCode >= http.StatusBadRequest {
+			span.RecordError(ErrorBadResponce)
+		}
+		span.End()
+		if parent, ok := request.Context().Value(spanKey{}).(Span); ok {
+			parent.SetAttributes(status)
+		}
+		return res, nil
+	})
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// testSpan is span recorded by testTracer
+type testSpan struct {
+	name   string
+	parent *testSpan
+	attrs  map[string]interface{}
+	errors []error
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.errors = append(s.errors, err)
+}
+
+func (s *testSpan) End() {
+	s.ended = true
+}
+
+type testSpanKey struct{}
+
+// testTracer records started spans and injects span name to header
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	span.SetAttributes(attrs...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (t *testTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		header.Set("X-Trace", span.name)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	Convey("Tracing", t, func() {
+		var (
+			traces []string
+			reject bool
+		)
+		callback := func(request *http.Request) (*http.Response, error) {
+			traces = append(traces, request.Header.Get("X-Trace"))
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			resp.Body = http.NoBody
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			switch {
+			case reject:
+				reject = false
+				resp.StatusCode = http.StatusUnauthorized
+			case request.Method == putMethod:
+				resp.StatusCode = http.StatusCreated
+			default:
+				resp.StatusCode = http.StatusNotFound
+			}
+			return resp, nil
+		}
+		tracer := new(testTracer)
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithTracer(tracer))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		So(tracer.spans, ShouldHaveLength, 3)
+		So(tracer.spans[0].name, ShouldEqual, "storage.Auth")
+		So(tracer.spans[1].name, ShouldEqual, "storage.authenticate")
+		So(tracer.spans[1].parent, ShouldEqual, tracer.spans[0])
+		So(tracer.spans[2].name, ShouldEqual, "HTTP GET")
+		So(tracer.spans[2].parent, ShouldEqual, tracer.spans[1])
+		So(tracer.spans[2].attrs[AttributeOperation], ShouldEqual, OperationAuth)
+		tracer.spans = nil
+		traces = nil
+
+		Convey("Upload", func() {
+			reject = true
+			So(c.Upload(bytes.NewReader([]byte("data")), "c", "o", "text/plain"), ShouldBeNil)
+			names := make([]string, len(tracer.spans))
+			for i, span := range tracer.spans {
+				names[i] = span.name
+				So(span.ended, ShouldBeTrue)
+			}
+			So(names, ShouldResemble, []string{
+				"storage.Upload", "storage.hash", "HTTP PUT",
+				"storage.authenticate", "HTTP GET", "HTTP PUT",
+			})
+			root := tracer.spans[0]
+			So(root.parent, ShouldBeNil)
+			So(root.attrs[AttributeContainer], ShouldEqual, "c")
+			So(root.attrs[AttributeObject], ShouldEqual, "o")
+			So(root.attrs[AttributeStatus], ShouldEqual, http.StatusCreated)
+			So(root.errors, ShouldBeEmpty)
+			So(tracer.spans[1].parent, ShouldEqual, root)
+			So(tracer.spans[1].attrs[AttributeSize], ShouldEqual, 4)
+
+			rejected, replayed := tracer.spans[2], tracer.spans[5]
+			So(rejected.parent, ShouldEqual, root)
+			So(rejected.attrs[AttributeStatus], ShouldEqual, http.StatusUnauthorized)
+			So(rejected.attrs[AttributeAttempt], ShouldEqual, 1)
+			So(rejected.errors, ShouldHaveLength, 1)
+			So(tracer.spans[3].parent, ShouldEqual, root)
+			So(tracer.spans[4].parent, ShouldEqual, tracer.spans[3])
+			So(tracer.spans[4].attrs[AttributeAttempt], ShouldEqual, 1)
+			So(replayed.parent, ShouldEqual, root)
+			So(replayed.attrs[AttributeAttempt], ShouldEqual, 2)
+			So(replayed.attrs[AttributeOperation], ShouldEqual, OperationUpload)
+			So(replayed.attrs[AttributeURL], ShouldEqual, "https://xxx.selcdn.ru/c/o")
+			So(replayed.errors, ShouldBeEmpty)
+
+			// each request carries context of its own span
+			So(traces, ShouldResemble, []string{"HTTP PUT", "HTTP GET", "HTTP PUT"})
+		})
+		Convey("Error", func() {
+			_, err := c.ObjectInfo("c", "missing")
+			So(err, ShouldEqual, ErrorObjectNotFound)
+			So(tracer.spans, ShouldHaveLength, 2)
+			root := tracer.spans[0]
+			So(root.name, ShouldEqual, "storage.ObjectInfo")
+			So(root.attrs[AttributeStatus], ShouldEqual, http.StatusNotFound)
+			So(root.errors, ShouldResemble, []error{ErrorObjectNotFound})
+			So(tracer.spans[1].errors, ShouldResemble, []error{ErrorBadResponce})
+		})
+	})
+	Convey("Noop tracer", t, func() {
+		c := newClient()
+		So(c.tracer, ShouldResemble, noopTracer{})
+		ctx, span := c.startSpan(context.Background(), "Info", "", "")
+		So(span, ShouldNotBeNil)
+		So(ctx.Value(spanKey{}), ShouldEqual, span)
+	})
+}
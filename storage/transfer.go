@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// TransferOption configures single upload or download
+type TransferOption func(t *transfer)
+
+// RateLimit limits transfer to bytesPerSecond, limit of client set by
+// WithRateLimit is applied too
+func RateLimit(bytesPerSecond int64) TransferOption {
+	return func(t *transfer) {
+		t.rate = bytesPerSecond
+	}
+}
+
+// Range downloads part of object from offset, length of zero or less
+// means rest of object
+func Range(offset, length int64) TransferOption {
+	return func(t *transfer) {
+		t.offset = offset
+		t.length = length
+	}
+}
+
+// RequestedRange returns range of object, that is requested by options,
+// e.g. for implementations of ObjectAPI
+func RequestedRange(opts ...TransferOption) (offset, length int64) {
+	t := newTransfer(opts, SystemClock)
+	return t.offset, t.length
+}
+
+// WithRateLimit sets global limit of bytes per second, that is shared
+// by all concurrent uploads and downloads of client
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(c *Client) {
+		c.rate = bytesPerSecond
+	}
+}
+
+// transfer is upload or download with options
+type transfer struct {
+	offset   int64
+	length   int64
+	manifest string
+	metadata map[string]string
+	encoding string
+	types    map[string]string
+	charset  string
+	rate     int64
+	progress ProgressFunc
+	limiters []*limiter
+	clock    Clock
+}
+
+// newTransfer returns transfer with options
+func newTransfer(opts []TransferOption, clock Clock) *transfer {
+	t := &transfer{clock: clock, charset: defaultCharset}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// transfer returns transfer with options and limiter of client
+func (c *Client) transfer(opts []TransferOption) *transfer {
+	t := newTransfer(opts, c.clock)
+	if t.rate > 0 {
+		t.limiters = append(t.limiters, newLimiter(t.rate, c.clock))
+	}
+	if c.limiter != nil {
+		t.limiters = append(t.limiters, c.limiter)
+	}
+	return t
+}
+
+// objectTransfer returns transfer with api client if it is *Client,
+// otherwise transfer is not limited
+func objectTransfer(api API, opts []TransferOption) *transfer {
+	if c, ok := api.(*Client); ok {
+		return c.transfer(opts)
+	}
+	return newTransfer(opts, SystemClock)
+}
+
+// ranged returns true if part of object is requested
+func (t *transfer) ranged() bool {
+	return t.offset > 0 || t.length > 0
+}
+
+// rangeHeader returns value of Range header
+func (t *transfer) rangeHeader() string {
+	if t.length <= 0 {
+		return fmt.Sprintf("bytes=%d-", t.offset)
+	}
+	return fmt.Sprintf("bytes=%d-%d", t.offset, t.offset+t.length-1)
+}
+
+// observe returns reader, that reports progress of phase with total bytes
+func (t *transfer) observe(r io.Reader, phase string, total int64) io.Reader {
+	if t.progress == nil {
+		return r
+	}
+	return &progressReader{
+		r:        r,
+		clock:    t.clock,
+		start:    t.clock.Now(),
+		progress: Progress{Phase: phase, Total: total},
+		callback: t.progress,
+	}
+}
+
+// reader returns reader, that transfers data from r with limits and
+// reports progress of phase
+func (t *transfer) reader(r io.Reader, phase string, total int64) io.Reader {
+	if len(t.limiters) > 0 {
+		r = &limitedReader{r: r, limiters: t.limiters}
+	}
+	return t.observe(r, phase, total)
+}
+
+// readCloser returns reader of body, that is closed with body
+func (t *transfer) readCloser(body io.ReadCloser, phase string, total int64) io.ReadCloser {
+	reader := t.reader(body, phase, total)
+	if reader == io.Reader(body) {
+		return body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, body}
+}
@@ -1,15 +1,15 @@
 package storage
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"io"
 	"io/ioutil"
-	"mime"
 	"net/http"
 	"os"
-	"path/filepath"
 	"path"
+	"strconv"
 )
 
 const (
@@ -55,8 +55,10 @@ func (c *Client) fileStat(name string) (os.FileInfo, error) {
 	return os.Stat(name)
 }
 
-// UploadFile to container
-func (c *Client) UploadFile(filename, container string) error {
+// UploadFile to container, content type is detected by DetectContentType
+func (c *Client) UploadFile(filename, container string, opts ...TransferOption) (err error) {
+	ctx, span := c.startSpan(context.Background(), "UploadFile", container, "")
+	defer endSpan(span, &err)
 	f, err := c.fileOpen(filename)
 	if err != nil {
 		return err
@@ -65,44 +67,76 @@ func (c *Client) UploadFile(filename, container string) error {
 	if err != nil {
 		return err
 	}
-	ext := filepath.Ext(filename)
-	mimetype := mime.TypeByExtension(ext)
-	return c.Upload(f, container, stats.Name(), mimetype)
+	span.SetAttributes(Attribute{AttributeObject, stats.Name()}, Attribute{AttributeSize, stats.Size()})
+	// content type is detected by upload
+	return c.upload(ctx, f, container, stats.Name(), "", true, c.transfer(opts))
 }
 
-func (c *Client) upload(reader io.Reader, container, filename, contentType string, check bool) error {
-	var etag string
+func (c *Client) upload(ctx context.Context, reader io.Reader, container, filename, contentType string, check bool, t *transfer) error {
+	var etag, temp string
 	closer, ok := reader.(io.ReadCloser)
 	if ok {
 		defer closer.Close()
 	}
+	if blank(contentType) {
+		var err error
+		if contentType, reader, err = t.detect(filename, reader); err != nil {
+			return err
+		}
+	}
+	total := size(reader)
+
+	var counter *countingReader
+	if !blank(t.encoding) {
+		// data is compressed after hash progress, that counts bytes of file
+		counter = &countingReader{Reader: t.observe(reader, PhaseHash, total)}
+		compressed, err := CompressReader(counter, t.encoding)
+		if err != nil {
+			return err
+		}
+		defer compressed.Close()
+		reader = compressed
+	}
 
 	if check {
 		f, err := ioutil.TempFile(os.TempDir(), path.Base(filename))
 		if err != nil {
 			return err
 		}
-		stat, _ := f.Stat()
-		path := stat.Name()
-		hasher := md5.New()
-		writer := io.MultiWriter(f, hasher)
-		_, err = io.Copy(writer, reader)
-		f.Close()
-		if err != nil {
+		temp = f.Name()
+		defer os.Remove(temp)
+		source := reader
+		if counter == nil {
+			source = t.observe(reader, PhaseHash, total)
+		}
+		if etag, total, err = c.hash(ctx, f, source); err != nil {
 			return err
 		}
-		etag = hex.EncodeToString(hasher.Sum(nil))
-		reader, err = os.Open(filepath.Join(os.TempDir(), path))
-		defer os.Remove(path)
+		if counter != nil {
+			Metadata(OriginalSizeKey, strconv.FormatInt(counter.n, 10))(t)
+		}
+		file, err := os.Open(temp)
 		if err != nil {
 			return err
 		}
+		defer file.Close()
+		reader = file
 	}
 
-	request, err := c.NewRequest(putMethod, reader, container, filename)
+	request, err := c.newRequest(ctx, putMethod, t.reader(reader, PhaseUpload, total), container, filename)
 	if err != nil {
 		return err
 	}
+	if !blank(temp) {
+		// temporary file is opened again to replay request after re-auth
+		request.GetBody = func() (io.ReadCloser, error) {
+			f, err := os.Open(temp)
+			if err != nil {
+				return nil, err
+			}
+			return t.readCloser(f, PhaseUpload, total), nil
+		}
+	}
 	if !blank(contentType) {
 		request.Header.Add(contentTypeHeader, contentType)
 	}
@@ -110,6 +144,13 @@ func (c *Client) upload(reader io.Reader, container, filename, contentType strin
 	if !blank(etag) {
 		request.Header.Add(etagHeader, etag)
 	}
+	if !blank(t.manifest) {
+		request.Header.Add(manifestHeader, escapeManifest(t.manifest))
+	}
+	if !blank(t.encoding) {
+		request.Header.Add(contentEncodingHeader, t.encoding)
+	}
+	t.setMetadata(request.Header)
 
 	res, err := c.do(request)
 	if err != nil {
@@ -124,7 +165,25 @@ func (c *Client) upload(reader io.Reader, container, filename, contentType strin
 	return nil
 }
 
-// Upload reads all data from reader and uploads to contaier with filename and content type
-func (c *Client) Upload(reader io.Reader, container, filename, contentType string) error {
-	return c.upload(reader, container, filename, contentType, true)
+// hash copies reader to temporary file and returns md5 and size of data
+func (c *Client) hash(ctx context.Context, f *os.File, reader io.Reader) (etag string, n int64, err error) {
+	_, span := c.tracer.Start(ctx, spanPrefix+"hash")
+	defer endSpan(span, &err)
+	hasher := md5.New()
+	writer := io.MultiWriter(f, hasher)
+	n, err = io.Copy(writer, reader)
+	f.Close()
+	if err != nil {
+		return "", 0, err
+	}
+	span.SetAttributes(Attribute{AttributeSize, n})
+	return hex.EncodeToString(hasher.Sum(nil)), n, nil
+}
+
+// Upload reads all data from reader and uploads to contaier with filename and content type,
+// blank content type is detected by DetectContentType
+func (c *Client) Upload(reader io.Reader, container, filename, contentType string, opts ...TransferOption) (err error) {
+	ctx, span := c.startSpan(context.Background(), "Upload", container, filename)
+	defer endSpan(span, &err)
+	return c.upload(ctx, reader, container, filename, contentType, true, c.transfer(opts))
 }
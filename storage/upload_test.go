@@ -12,7 +12,7 @@ import (
 )
 
 func TestUpload(t *testing.T) {
-	c := newClient(nil)
+	c := newClient()
 	Convey("Upload", t, func() {
 		resp := new(http.Response)
 		resp.Header = http.Header{}
@@ -46,6 +46,30 @@ func TestUpload(t *testing.T) {
 					So(c.Container("container").Object("filename").Upload(data, "text/plain"), ShouldBeNil)
 				})
 			})
+			Convey("Manifest and metadata", func() {
+				callback := func(request *http.Request) (resp *http.Response, err error) {
+					resp = new(http.Response)
+					So(request.Header.Get("X-Object-Manifest"), ShouldEqual, "segments/filename/")
+					So(request.Header.Get("X-Object-Meta-Original-Size"), ShouldEqual, "10")
+					resp.StatusCode = http.StatusCreated
+					return
+				}
+				c.setClient(NewTestClient(callback))
+				So(c.Upload(bytes.NewBufferString(""), "container", "filename", "text/plain",
+					Manifest("segments/filename/"), Metadata("original-size", "10")), ShouldBeNil)
+				So(RequestedManifest(Manifest("segments/filename/")), ShouldEqual, "segments/filename/")
+			})
+			Convey("Escaped manifest", func() {
+				callback := func(request *http.Request) (resp *http.Response, err error) {
+					resp = new(http.Response)
+					So(request.Header.Get("X-Object-Manifest"), ShouldEqual, "my%20segments/file%25name/%D1%84/")
+					resp.StatusCode = http.StatusCreated
+					return
+				}
+				c.setClient(NewTestClient(callback))
+				So(c.Upload(bytes.NewBufferString(""), "container", "filename", "text/plain",
+					Manifest("my segments/file%name/ф/")), ShouldBeNil)
+			})
 			Convey("Not found", func() {
 				callback := func(request *http.Request) (resp *http.Response, err error) {
 					resp = new(http.Response)
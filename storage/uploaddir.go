@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ernado/selectel/storage/internal/batch"
+	"io/fs"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	defaultDirWorkers    = 4
+	defaultDirRetries    = 2
+	defaultDirRetryDelay = time.Second
+)
+
+var (
+	// ErrorUploadFailed is returned by UploadDir if some files are not uploaded
+	ErrorUploadFailed = errors.New("Unable to upload some files")
+	// ErrorNotDirectory is returned by UploadDir if path is not directory
+	ErrorNotDirectory = errors.New("Path is not a directory")
+)
+
+// FileResult is result of upload of single file of directory
+type FileResult struct {
+	// Path is path of local file
+	Path string
+	// Name is name of object, that is relative path separated by slash
+	Name string
+	Size int64
+	// Attempts is count of uploads of file including retries
+	Attempts int
+	Err      error
+}
+
+// UploadSummary is result of UploadDir
+type UploadSummary struct {
+	// Files are results of all files sorted by name
+	Files    []FileResult
+	Uploaded int
+	Failed   int
+	// Bytes is size of uploaded files
+	Bytes int64
+}
+
+func (s UploadSummary) String() string {
+	return fmt.Sprintf("%d files uploaded (%d bytes), %d failed", s.Uploaded, s.Bytes, s.Failed)
+}
+
+// DirOption configures UploadDir
+type DirOption func(u *dirUpload)
+
+// Workers sets count of files, that are uploaded in parallel, 4 by default
+func Workers(n int) DirOption {
+	return func(u *dirUpload) {
+		u.workers = n
+	}
+}
+
+// Retries sets count of retries of failed upload of file, 2 by default
+func Retries(n int) DirOption {
+	return func(u *dirUpload) {
+		u.retries = n
+	}
+}
+
+// RetryDelay sets delay before first retry, that is doubled for next
+// retries, 1 second by default
+func RetryDelay(d time.Duration) DirOption {
+	return func(u *dirUpload) {
+		u.delay = d
+	}
+}
+
+// DirPrefix adds prefix to names of objects, e.g. "build/"
+func DirPrefix(prefix string) DirOption {
+	return func(u *dirUpload) {
+		u.prefix = prefix
+	}
+}
+
+// OnFile calls f after upload of every file, f can be called concurrently
+func OnFile(f func(FileResult)) DirOption {
+	return func(u *dirUpload) {
+		u.report = f
+	}
+}
+
+// FileOptions sets transfer options of upload of every file, e.g. Compress
+func FileOptions(opts ...TransferOption) DirOption {
+	return func(u *dirUpload) {
+		u.transfer = append(u.transfer, opts...)
+	}
+}
+
+// DirClock sets clock of retry delays, SystemClock by default
+func DirClock(clock Clock) DirOption {
+	return func(u *dirUpload) {
+		u.clock = clock
+	}
+}
+
+// dirUpload is upload of directory with options
+type dirUpload struct {
+	container ContainerAPI
+	workers   int
+	retries   int
+	delay     time.Duration
+	prefix    string
+	report    func(FileResult)
+	transfer  []TransferOption
+	clock     Clock
+}
+
+// UploadDir uploads regular files of directory recursively to container,
+// relative paths of files separated by slash are names of objects. Files
+// are uploaded by workers and failed uploads are retried, ErrorUploadFailed
+// is returned with summary if some files are not uploaded
+func UploadDir(container ContainerAPI, dir string, opts ...DirOption) (UploadSummary, error) {
+	u := &dirUpload{
+		container: container,
+		workers:   defaultDirWorkers,
+		retries:   defaultDirRetries,
+		delay:     defaultDirRetryDelay,
+		clock:     SystemClock,
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	var summary UploadSummary
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return summary, err
+	}
+	if !stat.IsDir() {
+		return summary, ErrorNotDirectory
+	}
+	err = batch.Files(dir, func(name, path string, info fs.FileInfo) error {
+		summary.Files = append(summary.Files, FileResult{Path: path, Name: u.prefix + name, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+	sort.Slice(summary.Files, func(i, j int) bool {
+		return summary.Files[i].Name < summary.Files[j].Name
+	})
+	batch.Run(u.workers, len(summary.Files), func(i int) {
+		u.upload(&summary.Files[i])
+		if u.report != nil {
+			u.report(summary.Files[i])
+		}
+	})
+	for _, file := range summary.Files {
+		if file.Err != nil {
+			summary.Failed++
+			continue
+		}
+		summary.Uploaded++
+		summary.Bytes += file.Size
+	}
+	if summary.Failed > 0 {
+		return summary, ErrorUploadFailed
+	}
+	return summary, nil
+}
+
+// upload uploads file with retries and backoff
+func (u *dirUpload) upload(file *FileResult) {
+	delay := u.delay
+	for {
+		file.Attempts++
+		if file.Err = u.uploadOnce(file); file.Err == nil || file.Attempts > u.retries {
+			return
+		}
+		if delay > 0 {
+			<-u.clock.NewTimer(delay).C()
+			delay *= 2
+		}
+	}
+}
+
+func (u *dirUpload) uploadOnce(file *FileResult) error {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return u.container.Upload(f, file.Name, "", u.transfer...)
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestUploadDir(t *testing.T) {
+	Convey("UploadDir", t, func() {
+		dir, err := ioutil.TempDir("", "uploaddir")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		for name, data := range map[string]string{
+			"index.html":        "<h1>index</h1>",
+			"static/app.js":     "app()",
+			"static/img/a.png":  "png",
+			"static/flaky.json": "{}",
+			"static/broken.txt": "broken",
+		} {
+			p := filepath.Join(dir, filepath.FromSlash(name))
+			So(os.MkdirAll(filepath.Dir(p), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(p, []byte(data), 0644), ShouldBeNil)
+		}
+		var (
+			mu       sync.Mutex
+			uploaded = make(map[string]string)
+			attempts = make(map[string]int)
+			sources  = make(map[string]string)
+		)
+		clock := &sleepClock{testClock: newTestClock()}
+		callback := func(request *http.Request) (*http.Response, error) {
+			resp := new(http.Response)
+			resp.Header = http.Header{}
+			if request.URL.String() == "https://auth.selcdn.ru/" {
+				resp.StatusCode = http.StatusNoContent
+				resp.Header.Add("X-Expire-Auth-Token", "110")
+				resp.Header.Add("X-Auth-Token", "token")
+				resp.Header.Add("X-Storage-Url", "https://xxx.selcdn.ru/")
+				return resp, nil
+			}
+			data, _ := ioutil.ReadAll(request.Body)
+			mu.Lock()
+			defer mu.Unlock()
+			name := request.URL.Path
+			attempts[name]++
+			switch {
+			case name == "/c/build/static/broken.txt",
+				name == "/c/build/static/flaky.json" && attempts[name] == 1:
+				resp.StatusCode = http.StatusInternalServerError
+			default:
+				uploaded[name] = request.Header.Get(contentTypeHeader) + " " + string(data)
+				sources[name] = request.Header.Get("X-Object-Meta-Source")
+				resp.StatusCode = http.StatusCreated
+			}
+			return resp, nil
+		}
+		c := newClient(WithHTTPClient(NewTestClient(callback)), WithClock(clock))
+		So(c.Auth("user", "key"), ShouldBeNil)
+		var reported []FileResult
+		summary, err := UploadDir(c.Container("c"), dir, DirPrefix("build/"), Workers(3), DirClock(clock), FileOptions(Metadata("source", "dist")), OnFile(func(r FileResult) {
+			mu.Lock()
+			reported = append(reported, r)
+			mu.Unlock()
+		}))
+		So(err, ShouldEqual, ErrorUploadFailed)
+		So(reported, ShouldHaveLength, 5)
+		So(summary.Uploaded, ShouldEqual, 4)
+		So(summary.Failed, ShouldEqual, 1)
+		So(summary.Bytes, ShouldEqual, len("<h1>index</h1>app()png{}"))
+		So(summary.String(), ShouldEqual, "4 files uploaded (24 bytes), 1 failed")
+		var names []string
+		for _, file := range summary.Files {
+			names = append(names, file.Name)
+		}
+		So(names, ShouldResemble, []string{"build/index.html", "build/static/app.js", "build/static/broken.txt", "build/static/flaky.json", "build/static/img/a.png"})
+		So(summary.Files[2].Err, ShouldEqual, ErrorBadResponce)
+		So(summary.Files[2].Attempts, ShouldEqual, 3)
+		So(summary.Files[3].Err, ShouldBeNil)
+		So(summary.Files[3].Attempts, ShouldEqual, 2)
+		So(uploaded["/c/build/static/app.js"], ShouldStartWith, "text/javascript")
+		So(uploaded["/c/build/static/app.js"], ShouldContainSubstring, " app()")
+		So(sources["/c/build/index.html"], ShouldEqual, "dist")
+		So(clock.sleeps, ShouldHaveLength, 3)
+
+		_, err = UploadDir(c.Container("c"), filepath.Join(dir, "missing"))
+		So(os.IsNotExist(err), ShouldBeTrue)
+		_, err = UploadDir(c.Container("c"), filepath.Join(dir, "index.html"))
+		So(err, ShouldEqual, ErrorNotDirectory)
+	})
+}